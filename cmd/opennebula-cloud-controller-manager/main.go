@@ -32,7 +32,7 @@ import (
 	_ "k8s.io/component-base/metrics/prometheus/version"  // for version metric registration
 	"k8s.io/klog/v2"
 
-	_ "github.com/OpenNebula/cloud-provider-opennebula/pkg/cloud"
+	opennebula "github.com/OpenNebula/cloud-provider-opennebula/pkg/cloud"
 )
 
 func main() {
@@ -42,12 +42,57 @@ func main() {
 	}
 
 	fss := cliflag.NamedFlagSets{}
-	command := app.NewCloudControllerManagerCommand(ccmOptions, cloudInitializer, app.DefaultInitFuncConstructors, names.CCMControllerAliases(), fss, wait.NeverStop)
+	command := app.NewCloudControllerManagerCommand(ccmOptions, cloudInitializer, controllerInitializers(), controllerAliases(), fss, wait.NeverStop)
 
 	code := cli.Run(command)
 	os.Exit(code)
 }
 
+func controllerInitializers() map[string]app.ControllerInitFuncConstructor {
+	controllerInitializers := app.DefaultInitFuncConstructors
+	controllerInitializers[opennebula.NodeIPAMControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{
+			ClientName: opennebula.NodeIPAMControllerName,
+		},
+		Constructor: opennebula.StartNodeIPAMControllerWrapper,
+	}
+	controllerInitializers[opennebula.HostTaintControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{
+			ClientName: opennebula.HostTaintControllerName,
+		},
+		Constructor: opennebula.StartHostTaintControllerWrapper,
+	}
+	controllerInitializers[opennebula.NodeMetadataControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{
+			ClientName: opennebula.NodeMetadataControllerName,
+		},
+		Constructor: opennebula.StartNodeMetadataControllerWrapper,
+	}
+	controllerInitializers[opennebula.LoadBalancerClassControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{
+			ClientName: opennebula.LoadBalancerClassControllerName,
+		},
+		Constructor: opennebula.StartLoadBalancerClassControllerWrapper,
+	}
+	controllerInitializers[opennebula.LocalTrafficControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{
+			ClientName: opennebula.LocalTrafficControllerName,
+		},
+		Constructor: opennebula.StartLocalTrafficControllerWrapper,
+	}
+	return controllerInitializers
+}
+
+func controllerAliases() map[string]string {
+	controllerAliases := names.CCMControllerAliases()
+	controllerAliases[opennebula.NodeIPAMControllerAlias] = opennebula.NodeIPAMControllerName
+	controllerAliases[opennebula.HostTaintControllerAlias] = opennebula.HostTaintControllerName
+	controllerAliases[opennebula.NodeMetadataControllerAlias] = opennebula.NodeMetadataControllerName
+	controllerAliases[opennebula.LoadBalancerClassControllerAlias] = opennebula.LoadBalancerClassControllerName
+	controllerAliases[opennebula.LocalTrafficControllerAlias] = opennebula.LocalTrafficControllerName
+	return controllerAliases
+}
+
 func cloudInitializer(config *config.CompletedConfig) cloudprovider.Interface {
 	cloudConfig := config.ComponentConfig.KubeCloudShared.CloudProvider
 
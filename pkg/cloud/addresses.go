@@ -0,0 +1,190 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+var (
+	// NOTE: Link-local addresses (IP6_LINK) are never reported.
+	addressKeys = []string{"IP", "IP6", "IP6_GLOBAL", "IP6_ULA"}
+)
+
+// resolveNodeAddresses validates the config and derives missing selectors from privateNetwork/publicNetwork.
+func resolveNodeAddresses(cfg OpenNebulaConfig) (ONENodeAddresses, error) {
+	resolved := ONENodeAddresses{}
+	if cfg.NodeAddresses != nil {
+		resolved = *cfg.NodeAddresses
+	}
+	switch corev1.IPFamily(resolved.PreferredFamily) {
+	case "", corev1.IPv4Protocol, corev1.IPv6Protocol:
+	default:
+		return resolved, fmt.Errorf("unexpected preferredFamily: %s", resolved.PreferredFamily)
+	}
+	if resolved.Internal == nil && cfg.PrivateNetwork != nil {
+		resolved.Internal = &ONEAddressSelector{Networks: []string{cfg.PrivateNetwork.Name}}
+	}
+	if resolved.External == nil && cfg.PublicNetwork != nil {
+		resolved.External = &ONEAddressSelector{Networks: []string{cfg.PublicNetwork.Name}}
+	}
+	return resolved, nil
+}
+
+func (s *ONEAddressSelector) matches(nicID int, network, networkID string) bool {
+	if s == nil {
+		return false
+	}
+	for _, v := range s.NICs {
+		if v == nicID {
+			return true
+		}
+	}
+	for _, v := range s.Networks {
+		if (len(network) > 0 && v == network) || (len(networkID) > 0 && v == networkID) {
+			return true
+		}
+	}
+	return false
+}
+
+// nicAddresses returns IPv4 and IPv6 addresses of a NIC, taken from both the CONTEXT/ETH<NIC_ID>_* keys and the NIC itself.
+func nicAddresses(vm *goca_vm.VM, nicID int) ([]string, []string) {
+	ipv4, ipv6 := []string{}, []string{}
+	seen := map[string]struct{}{}
+
+	add := func(s string) {
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil || ip.IsLinkLocalUnicast() {
+			return
+		}
+		addr := ip.String()
+		if _, ok := seen[addr]; ok {
+			return
+		}
+		seen[addr] = struct{}{}
+		if ip.To4() != nil {
+			ipv4 = append(ipv4, addr)
+		} else {
+			ipv6 = append(ipv6, addr)
+		}
+	}
+
+	if contextVec, err := vm.Template.GetVector("CONTEXT"); err == nil {
+		for _, k := range addressKeys {
+			if v, err := contextVec.GetStr(fmt.Sprintf("ETH%d_%s", nicID, k)); err == nil {
+				add(v)
+			}
+		}
+	}
+	for _, nic := range vm.Template.GetNICs() {
+		if id, err := nic.ID(); err != nil || id != nicID {
+			continue
+		}
+		for _, k := range addressKeys {
+			if v, err := nic.GetStr(k); err == nil {
+				add(v)
+			}
+		}
+	}
+
+	return ipv4, ipv6
+}
+
+// orderByFamily puts addresses of the preferred family first, kubelet takes the first one as primary.
+func orderByFamily(ipv4, ipv6 []string, preferredFamily string) []string {
+	if corev1.IPFamily(preferredFamily) == corev1.IPv6Protocol {
+		return append(append([]string{}, ipv6...), ipv4...)
+	}
+	return append(append([]string{}, ipv4...), ipv6...)
+}
+
+// hostname returns CONTEXT/SET_HOSTNAME if defined, VM name otherwise.
+func hostname(vm *goca_vm.VM) string {
+	if v, err := vm.Template.GetStrFromVec("CONTEXT", "SET_HOSTNAME"); err == nil && len(strings.TrimSpace(v)) > 0 {
+		return strings.TrimSpace(v)
+	}
+	return vm.Name
+}
+
+func dnsName(hostname, suffix string) string {
+	suffix = strings.Trim(suffix, ".")
+	if len(suffix) == 0 || strings.HasSuffix(hostname, "."+suffix) {
+		return hostname
+	}
+	return fmt.Sprintf("%s.%s", strings.SplitN(hostname, ".", 2)[0], suffix)
+}
+
+func (i2 *InstancesV2) nodeAddresses(vm *goca_vm.VM) ([]corev1.NodeAddress, error) {
+	var internal4, internal6, external4, external6 []string
+	for _, nic := range vm.Template.GetNICs() {
+		nicID, err := nic.ID()
+		if err != nil {
+			continue
+		}
+		network, _ := nic.GetStr("NETWORK")
+		networkID, _ := nic.GetStr("NETWORK_ID")
+
+		ipv4, ipv6 := nicAddresses(vm, nicID)
+		if i2.nodeAddressing.Internal.matches(nicID, network, networkID) {
+			internal4, internal6 = append(internal4, ipv4...), append(internal6, ipv6...)
+		}
+		if i2.nodeAddressing.External.matches(nicID, network, networkID) {
+			external4, external6 = append(external4, ipv4...), append(external6, ipv6...)
+		}
+	}
+
+	// NOTE: Fall back to ETH0 for InternalIP and to InternalIP for ExternalIP, like it always used to be.
+	internal := orderByFamily(internal4, internal6, i2.nodeAddressing.PreferredFamily)
+	if len(internal) == 0 {
+		ipv4, ipv6 := nicAddresses(vm, 0)
+		internal = orderByFamily(ipv4, ipv6, i2.nodeAddressing.PreferredFamily)
+	}
+	if len(internal) == 0 {
+		return nil, fmt.Errorf("no addresses found for VM %d", vm.ID)
+	}
+	external := orderByFamily(external4, external6, i2.nodeAddressing.PreferredFamily)
+	if len(external) == 0 {
+		external = internal
+	}
+
+	nodeAddresses := make([]corev1.NodeAddress, 0, len(internal)+len(external)+3)
+	for _, ip := range internal {
+		nodeAddresses = append(nodeAddresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: ip})
+	}
+	for _, ip := range external {
+		nodeAddresses = append(nodeAddresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: ip})
+	}
+
+	if name := hostname(vm); len(name) > 0 {
+		nodeAddresses = append(nodeAddresses, corev1.NodeAddress{Type: corev1.NodeHostName, Address: name})
+		if len(i2.nodeAddressing.InternalDNSSuffix) > 0 {
+			nodeAddresses = append(nodeAddresses, corev1.NodeAddress{Type: corev1.NodeInternalDNS, Address: dnsName(name, i2.nodeAddressing.InternalDNSSuffix)})
+		}
+		if len(i2.nodeAddressing.ExternalDNSSuffix) > 0 {
+			nodeAddresses = append(nodeAddresses, corev1.NodeAddress{Type: corev1.NodeExternalDNS, Address: dnsName(name, i2.nodeAddressing.ExternalDNSSuffix)})
+		}
+	}
+
+	return nodeAddresses, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const dualStackVM = `<VM><ID>20</ID><NAME>node0</NAME><TEMPLATE>
+<CONTEXT><ETH0_IP>172.20.0.102</ETH0_IP><ETH0_IP6>2001:db8::102</ETH0_IP6><ETH0_IP6_ULA>fd00::102</ETH0_IP6_ULA></CONTEXT>
+<NIC><NIC_ID>0</NIC_ID><NETWORK>private</NETWORK><IP>172.20.0.102</IP><IP6_GLOBAL>2001:db8::102</IP6_GLOBAL><IP6_LINK>fe80::102</IP6_LINK></NIC>
+<NIC><NIC_ID>1</NIC_ID><NETWORK>service</NETWORK><IP>10.2.11.102</IP></NIC>
+</TEMPLATE></VM>`
+
+func mustParseVM(t *testing.T, s string) *goca_vm.VM {
+	vm := &goca_vm.VM{}
+	if err := xml.Unmarshal([]byte(s), vm); err != nil {
+		t.Fatal(err)
+	}
+	return vm
+}
+
+func TestNicAddresses(t *testing.T) {
+	vm := mustParseVM(t, dualStackVM)
+
+	ipv4, ipv6 := nicAddresses(vm, 0)
+	assert.Equal(t, []string{"172.20.0.102"}, ipv4)
+	assert.Equal(t, []string{"2001:db8::102", "fd00::102"}, ipv6)
+
+	ipv4, ipv6 = nicAddresses(vm, 1)
+	assert.Equal(t, []string{"10.2.11.102"}, ipv4)
+	assert.Empty(t, ipv6)
+}
+
+func TestNodeAddressesPreferredFamily(t *testing.T) {
+	vm := mustParseVM(t, dualStackVM)
+
+	i2 := &InstancesV2{nodeAddressing: ONENodeAddresses{PreferredFamily: "IPv6"}}
+	nodeAddresses, err := i2.nodeAddresses(vm)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "2001:db8::102"},
+		{Type: corev1.NodeInternalIP, Address: "fd00::102"},
+		{Type: corev1.NodeInternalIP, Address: "172.20.0.102"},
+		{Type: corev1.NodeExternalIP, Address: "2001:db8::102"},
+		{Type: corev1.NodeExternalIP, Address: "fd00::102"},
+		{Type: corev1.NodeExternalIP, Address: "172.20.0.102"},
+		{Type: corev1.NodeHostName, Address: "node0"},
+	}, nodeAddresses)
+
+	_, err = resolveNodeAddresses(OpenNebulaConfig{NodeAddresses: &ONENodeAddresses{PreferredFamily: "IPv5"}})
+	assert.NotNil(t, err)
+}
+
+func TestNodeAddressesByNetwork(t *testing.T) {
+	vm := mustParseVM(t, dualStackVM)
+
+	nodeAddressing, err := resolveNodeAddresses(OpenNebulaConfig{
+		PublicNetwork:  &ONEVirtualNetwork{Name: "service"},
+		PrivateNetwork: &ONEVirtualNetwork{Name: "private"},
+	})
+	assert.Nil(t, err)
+	i2 := &InstancesV2{nodeAddressing: nodeAddressing}
+	nodeAddresses, err := i2.nodeAddresses(vm)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "172.20.0.102"},
+		{Type: corev1.NodeInternalIP, Address: "2001:db8::102"},
+		{Type: corev1.NodeInternalIP, Address: "fd00::102"},
+		{Type: corev1.NodeExternalIP, Address: "10.2.11.102"},
+		{Type: corev1.NodeHostName, Address: "node0"},
+	}, nodeAddresses)
+
+	i2 = &InstancesV2{nodeAddressing: ONENodeAddresses{
+		Internal: &ONEAddressSelector{NICs: []int{1}},
+		External: &ONEAddressSelector{Networks: []string{"asd"}},
+	}}
+	nodeAddresses, err = i2.nodeAddresses(vm)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "10.2.11.102"},
+		{Type: corev1.NodeExternalIP, Address: "10.2.11.102"},
+		{Type: corev1.NodeHostName, Address: "node0"},
+	}, nodeAddresses)
+}
+
+func TestNodeAddressesDNS(t *testing.T) {
+	vm := mustParseVM(t, `<VM><ID>21</ID><NAME>one-21</NAME><TEMPLATE>
+<CONTEXT><ETH0_IP>172.20.0.103</ETH0_IP><SET_HOSTNAME>worker1</SET_HOSTNAME></CONTEXT>
+<NIC><NIC_ID>0</NIC_ID><NETWORK>private</NETWORK><IP>172.20.0.103</IP></NIC>
+</TEMPLATE></VM>`)
+
+	i2 := &InstancesV2{nodeAddressing: ONENodeAddresses{
+		InternalDNSSuffix: "k8s.internal",
+		ExternalDNSSuffix: ".example.com.",
+	}}
+	nodeAddresses, err := i2.nodeAddresses(vm)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "172.20.0.103"},
+		{Type: corev1.NodeExternalIP, Address: "172.20.0.103"},
+		{Type: corev1.NodeHostName, Address: "worker1"},
+		{Type: corev1.NodeInternalDNS, Address: "worker1.k8s.internal"},
+		{Type: corev1.NodeExternalDNS, Address: "worker1.example.com"},
+	}, nodeAddresses)
+}
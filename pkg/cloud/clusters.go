@@ -0,0 +1,164 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const (
+	// USER_TEMPLATE attribute holding comma-separated node roles, e.g. "control-plane,worker".
+	nodeRolesAttribute = "K8S_NODE_ROLES"
+
+	lbObjectSuffix = "-lb"
+)
+
+var controlPlaneRoles = []string{"control-plane", "master"}
+
+// Clusters discovers Kubernetes clusters sharing the OpenNebula installation from the objects
+// created by LoadBalancer (the "<cluster>-lb" reservations and virtual routers) and, when the inventory
+// is configured, from cluster tags on VMs (listing every tag would need a scan of the whole VM pool).
+type Clusters struct {
+	ctrl                *goca.Controller
+	inventory           *Inventory
+	clusterTagAttribute string
+}
+
+func NewClusters(cfg OpenNebulaConfig, inventory *Inventory) *Clusters {
+	ctrl := goca.NewController(goca.NewDefaultClient(goca.OneConfig{
+		Endpoint: cfg.Endpoint.ONE_XMLRPC,
+		Token:    cfg.Endpoint.ONE_AUTH,
+	}))
+	return &Clusters{
+		ctrl:                ctrl,
+		inventory:           inventory,
+		clusterTagAttribute: resolveInstanceScope(cfg).ClusterTagAttribute,
+	}
+}
+
+func (c *Clusters) ListClusters(ctx context.Context) ([]string, error) {
+	names := map[string]struct{}{}
+
+	vnPool, err := c.ctrl.VirtualNetworks().InfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, vn := range vnPool.VirtualNetworks {
+		// NOTE: Only reservations are considered, regular networks may happen to end with "-lb" too.
+		if len(vn.ParentNetworkID) == 0 || !strings.HasSuffix(vn.Name, lbObjectSuffix) {
+			continue
+		}
+		names[strings.TrimSuffix(vn.Name, lbObjectSuffix)] = struct{}{}
+	}
+
+	vrPool, err := c.ctrl.VirtualRouters().InfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, vr := range vrPool.VirtualRouters {
+		if strings.HasSuffix(vr.Name, lbObjectSuffix) {
+			names[strings.TrimSuffix(vr.Name, lbObjectSuffix)] = struct{}{}
+		}
+	}
+
+	if c.inventory != nil {
+		vms, err := c.inventory.VMs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, vm := range vms {
+			if v, err := vm.UserTemplate.GetStr(c.clusterTagAttribute); err == nil && len(v) > 0 {
+				names[v] = struct{}{}
+			}
+		}
+	}
+
+	clusters := make([]string, 0, len(names))
+	for name := range names {
+		if len(name) > 0 {
+			clusters = append(clusters, name)
+		}
+	}
+	sort.Strings(clusters)
+	return clusters, nil
+}
+
+// Master returns the hostname of the control-plane VM with the lowest ID, control-plane VMs
+// are tagged with the cluster name and have a control-plane role in USER_TEMPLATE.
+func (c *Clusters) Master(ctx context.Context, clusterName string) (string, error) {
+	vms, err := c.clusterVMs(ctx, clusterName)
+	if err != nil {
+		return "", err
+	}
+	var master *goca_vm.VM
+	for _, vm := range vms {
+		if v, err := vm.UserTemplate.GetStr(c.clusterTagAttribute); err != nil || v != clusterName {
+			continue
+		}
+		if !hasControlPlaneRole(vm) {
+			continue
+		}
+		if master == nil || vm.ID < master.ID {
+			master = vm
+		}
+	}
+	if master == nil {
+		return "", fmt.Errorf("no control-plane VM found for cluster %s", clusterName)
+	}
+	return hostname(master), nil
+}
+
+// clusterVMs returns the VMs tagged with the cluster name, or a superset of them.
+func (c *Clusters) clusterVMs(ctx context.Context, clusterName string) ([]*goca_vm.VM, error) {
+	if c.inventory != nil {
+		return c.inventory.VMs(ctx)
+	}
+	filter := goca.NewVMFilterDefault()
+	if err := filter.SetPair("VM.USER_TEMPLATE."+c.clusterTagAttribute, clusterName); err != nil {
+		return nil, err
+	}
+	pool, err := c.ctrl.VMs().InfoExtendedFilterContext(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	vms := make([]*goca_vm.VM, len(pool.VMs))
+	for i := range pool.VMs {
+		vms[i] = &pool.VMs[i]
+	}
+	return vms, nil
+}
+
+func hasControlPlaneRole(vm *goca_vm.VM) bool {
+	roles, err := vm.UserTemplate.GetStr(nodeRolesAttribute)
+	if err != nil {
+		return false
+	}
+	for _, role := range strings.Split(roles, ",") {
+		for _, controlPlaneRole := range controlPlaneRoles {
+			if strings.TrimSpace(role) == controlPlaneRole {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusters(t *testing.T) {
+	one := newFakeONe(map[string]string{
+		"one.vnpool.info": `<VNET_POOL>
+<VNET><ID>1</ID><NAME>service</NAME><TEMPLATE></TEMPLATE></VNET>
+<VNET><ID>2</ID><NAME>blue-lb</NAME><PARENT_NETWORK_ID>1</PARENT_NETWORK_ID><TEMPLATE></TEMPLATE></VNET>
+<VNET><ID>3</ID><NAME>blue-vr</NAME><PARENT_NETWORK_ID>1</PARENT_NETWORK_ID><TEMPLATE></TEMPLATE></VNET>
+<VNET><ID>4</ID><NAME>public-lb</NAME><TEMPLATE></TEMPLATE></VNET>
+</VNET_POOL>`,
+		"one.vrouterpool.info": `<VROUTER_POOL><VROUTER><ID>0</ID><NAME>green-lb</NAME><VMS></VMS><TEMPLATE></TEMPLATE></VROUTER></VROUTER_POOL>`,
+		"one.vmpool.infoextended": `<VM_POOL>
+<VM><ID>11</ID><NAME>red-worker0</NAME><USER_TEMPLATE><K8S_CLUSTER>red</K8S_CLUSTER><K8S_NODE_ROLES>worker</K8S_NODE_ROLES></USER_TEMPLATE></VM>
+<VM><ID>12</ID><NAME>red-cp1</NAME><USER_TEMPLATE><K8S_CLUSTER>red</K8S_CLUSTER><K8S_NODE_ROLES>control-plane</K8S_NODE_ROLES></USER_TEMPLATE></VM>
+<VM><ID>10</ID><NAME>red-cp0</NAME><TEMPLATE><CONTEXT><SET_HOSTNAME>cp0.red</SET_HOSTNAME></CONTEXT></TEMPLATE><USER_TEMPLATE><K8S_CLUSTER>red</K8S_CLUSTER><K8S_NODE_ROLES>control-plane,etcd</K8S_NODE_ROLES></USER_TEMPLATE></VM>
+<VM><ID>13</ID><NAME>vm</NAME><USER_TEMPLATE></USER_TEMPLATE></VM>
+</VM_POOL>`,
+	})
+	defer one.Close()
+
+	cfg := OpenNebulaConfig{Endpoint: OpenNebulaEndpoint{ONE_XMLRPC: one.URL, ONE_AUTH: "oneadmin:test"}}
+
+	// Without the inventory VM tags are not listed, control-planes are looked up with a filtered pool query.
+	clusters := NewClusters(cfg, nil)
+
+	names, err := clusters.ListClusters(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"blue", "green"}, names)
+	assert.Equal(t, 0, one.callCount("one.vmpool.infoextended"))
+
+	master, err := clusters.Master(context.TODO(), "red")
+	assert.Nil(t, err)
+	assert.Equal(t, "cp0.red", master)
+	assert.Contains(t, one.stringParams("one.vmpool.infoextended"), "VM.USER_TEMPLATE.K8S_CLUSTER=red")
+
+	_, err = clusters.Master(context.TODO(), "blue")
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, one.callCount("one.vmpool.infoextended"))
+
+	// With the inventory everything is answered from a single pool query.
+	clusters = NewClusters(cfg, NewInventory(one.controller(), ONEInventory{}))
+
+	names, err = clusters.ListClusters(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"blue", "green", "red"}, names)
+
+	master, err = clusters.Master(context.TODO(), "red")
+	assert.Nil(t, err)
+	assert.Equal(t, "cp0.red", master)
+
+	_, err = clusters.Master(context.TODO(), "blue")
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, one.callCount("one.vmpool.infoextended"))
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"k8s.io/klog/v2"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const (
+	vmStateEventPrefix = "EVENT VM "
+
+	defaultEventsMinBackoff = 1 * time.Second
+	defaultEventsMaxBackoff = 2 * time.Minute
+
+	defaultEventsDoneRetention = 10 * time.Minute
+)
+
+var (
+	// Names used by goca (e.g. CLONINGFAILURE), these are accepted in the instanceStates config.
+	vmStatesByName    = map[string]goca_vm.State{}
+	vmLCMStatesByName = map[string]goca_vm.LCMState{}
+
+	// Names used by oned in event keys (e.g. CLONING_FAILURE), which differ from goca for some states.
+	vmStatesByEventName = map[string]goca_vm.State{
+		"INIT":            goca_vm.Init,
+		"PENDING":         goca_vm.Pending,
+		"HOLD":            goca_vm.Hold,
+		"ACTIVE":          goca_vm.Active,
+		"STOPPED":         goca_vm.Stopped,
+		"SUSPENDED":       goca_vm.Suspended,
+		"DONE":            goca_vm.Done,
+		"POWEROFF":        goca_vm.Poweroff,
+		"UNDEPLOYED":      goca_vm.Undeployed,
+		"CLONING":         goca_vm.Cloning,
+		"CLONING_FAILURE": goca_vm.CloningFailure,
+	}
+	vmLCMStatesByEventName = map[string]goca_vm.LCMState{
+		"LCM_INIT":                        goca_vm.LcmInit,
+		"PROLOG":                          goca_vm.Prolog,
+		"BOOT":                            goca_vm.Boot,
+		"RUNNING":                         goca_vm.Running,
+		"MIGRATE":                         goca_vm.Migrate,
+		"SAVE_STOP":                       goca_vm.SaveStop,
+		"SAVE_SUSPEND":                    goca_vm.SaveSuspend,
+		"SAVE_MIGRATE":                    goca_vm.SaveMigrate,
+		"PROLOG_MIGRATE":                  goca_vm.PrologMigrate,
+		"PROLOG_RESUME":                   goca_vm.PrologResume,
+		"EPILOG_STOP":                     goca_vm.EpilogStop,
+		"EPILOG":                          goca_vm.Epilog,
+		"SHUTDOWN":                        goca_vm.Shutdown,
+		"CLEANUP_RESUBMIT":                goca_vm.CleanupResubmit,
+		"UNKNOWN":                         goca_vm.Unknown,
+		"HOTPLUG":                         goca_vm.Hotplug,
+		"SHUTDOWN_POWEROFF":               goca_vm.ShutdownPoweroff,
+		"BOOT_UNKNOWN":                    goca_vm.BootUnknown,
+		"BOOT_POWEROFF":                   goca_vm.BootPoweroff,
+		"BOOT_SUSPENDED":                  goca_vm.BootSuspended,
+		"BOOT_STOPPED":                    goca_vm.BootStopped,
+		"CLEANUP_DELETE":                  goca_vm.CleanupDelete,
+		"HOTPLUG_SNAPSHOT":                goca_vm.HotplugSnapshot,
+		"HOTPLUG_NIC":                     goca_vm.HotplugNic,
+		"HOTPLUG_SAVEAS":                  goca_vm.HotplugSaveas,
+		"HOTPLUG_SAVEAS_POWEROFF":         goca_vm.HotplugSaveasPoweroff,
+		"HOTPLUG_SAVEAS_SUSPENDED":        goca_vm.HotplugSaveasSuspended,
+		"SHUTDOWN_UNDEPLOY":               goca_vm.ShutdownUndeploy,
+		"EPILOG_UNDEPLOY":                 goca_vm.EpilogUndeploy,
+		"PROLOG_UNDEPLOY":                 goca_vm.PrologUndeploy,
+		"BOOT_UNDEPLOY":                   goca_vm.BootUndeploy,
+		"HOTPLUG_PROLOG_POWEROFF":         goca_vm.HotplugPrologPoweroff,
+		"HOTPLUG_EPILOG_POWEROFF":         goca_vm.HotplugEpilogPoweroff,
+		"BOOT_MIGRATE":                    goca_vm.BootMigrate,
+		"BOOT_FAILURE":                    goca_vm.BootFailure,
+		"BOOT_MIGRATE_FAILURE":            goca_vm.BootMigrateFailure,
+		"PROLOG_MIGRATE_FAILURE":          goca_vm.PrologMigrateFailure,
+		"PROLOG_FAILURE":                  goca_vm.PrologFailure,
+		"EPILOG_FAILURE":                  goca_vm.EpilogFailure,
+		"EPILOG_STOP_FAILURE":             goca_vm.EpilogStopFailure,
+		"EPILOG_UNDEPLOY_FAILURE":         goca_vm.EpilogUndeployFailure,
+		"PROLOG_MIGRATE_POWEROFF":         goca_vm.PrologMigratePoweroff,
+		"PROLOG_MIGRATE_POWEROFF_FAILURE": goca_vm.PrologMigratePoweroffFailure,
+		"PROLOG_MIGRATE_SUSPEND":          goca_vm.PrologMigrateSuspend,
+		"PROLOG_MIGRATE_SUSPEND_FAILURE":  goca_vm.PrologMigrateSuspendFailure,
+		"BOOT_UNDEPLOY_FAILURE":           goca_vm.BootUndeployFailure,
+		"BOOT_STOPPED_FAILURE":            goca_vm.BootStoppedFailure,
+		"PROLOG_RESUME_FAILURE":           goca_vm.PrologResumeFailure,
+		"PROLOG_UNDEPLOY_FAILURE":         goca_vm.PrologUndeployFailure,
+		"DISK_SNAPSHOT_POWEROFF":          goca_vm.DiskSnapshotPoweroff,
+		"DISK_SNAPSHOT_REVERT_POWEROFF":   goca_vm.DiskSnapshotRevertPoweroff,
+		"DISK_SNAPSHOT_DELETE_POWEROFF":   goca_vm.DiskSnapshotDeletePoweroff,
+		"DISK_SNAPSHOT_SUSPENDED":         goca_vm.DiskSnapshotSuspended,
+		"DISK_SNAPSHOT_REVERT_SUSPENDED":  goca_vm.DiskSnapshotRevertSuspended,
+		"DISK_SNAPSHOT_DELETE_SUSPENDED":  goca_vm.DiskSnapshotDeleteSuspended,
+		"DISK_SNAPSHOT":                   goca_vm.DiskSnapshot,
+		"DISK_SNAPSHOT_DELETE":            goca_vm.DiskSnapshotDelete,
+		"PROLOG_MIGRATE_UNKNOWN":          goca_vm.PrologMigrateUnknown,
+		"PROLOG_MIGRATE_UNKNOWN_FAILURE":  goca_vm.PrologMigrateUnknownFailure,
+		"DISK_RESIZE":                     goca_vm.DiskResize,
+		"DISK_RESIZE_POWEROFF":            goca_vm.DiskResizePoweroff,
+		"DISK_RESIZE_UNDEPLOYED":          goca_vm.DiskResizeUndeployed,
+		"HOTPLUG_NIC_POWEROFF":            goca_vm.HotplugNicPoweroff,
+		"HOTPLUG_RESIZE":                  goca_vm.HotplugResize,
+		"HOTPLUG_SAVEAS_UNDEPLOYED":       goca_vm.HotplugSaveasUndeployed,
+		"HOTPLUG_SAVEAS_STOPPED":          goca_vm.HotplugSaveasStopped,
+		"BACKUP":                          goca_vm.Backup,
+		"BACKUP_POWEROFF":                 goca_vm.BackupPoweroff,
+		"RESTORE":                         goca_vm.Restore,
+	}
+)
+
+func init() {
+	for s := goca_vm.Init; s <= goca_vm.CloningFailure; s++ {
+		if name := s.String(); len(name) > 0 {
+			vmStatesByName[name] = s
+		}
+	}
+	for s := goca_vm.LcmInit; s <= goca_vm.Restore; s++ {
+		if name := s.String(); len(name) > 0 {
+			vmLCMStatesByName[name] = s
+		}
+	}
+}
+
+type vmStateEvent struct {
+	state    goca_vm.State
+	lcmState goca_vm.LCMState
+}
+
+// EventTracker follows VM state changes published on the OpenNebula ZeroMQ event bus.
+// Its view is only trusted while connected, otherwise callers must fall back to polling.
+type EventTracker struct {
+	endpoint   string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	doneRetention time.Duration
+
+	mu        sync.RWMutex
+	connected bool
+	states    map[int]vmStateEvent
+	done      map[int]time.Time // when VMs reached DONE
+}
+
+func NewEventTracker(cfg ONEEvents) (*EventTracker, error) {
+	if len(strings.TrimSpace(cfg.Endpoint)) == 0 {
+		return nil, fmt.Errorf("no events endpoint defined")
+	}
+	minBackoff, maxBackoff := defaultEventsMinBackoff, defaultEventsMaxBackoff
+	if cfg.MinBackoff != nil && *cfg.MinBackoff > 0 {
+		minBackoff = *cfg.MinBackoff
+	}
+	if cfg.MaxBackoff != nil && *cfg.MaxBackoff >= minBackoff {
+		maxBackoff = *cfg.MaxBackoff
+	}
+	return &EventTracker{
+		endpoint:      cfg.Endpoint,
+		minBackoff:    minBackoff,
+		maxBackoff:    maxBackoff,
+		doneRetention: defaultEventsDoneRetention,
+		states:        map[int]vmStateEvent{},
+		done:          map[int]time.Time{},
+	}, nil
+}
+
+// State returns the last observed state of the VM, if any.
+func (et *EventTracker) State(vmID int) (goca_vm.State, goca_vm.LCMState, bool) {
+	et.mu.RLock()
+	defer et.mu.RUnlock()
+	if !et.connected {
+		return -1, -1, false
+	}
+	ev, ok := et.states[vmID]
+	return ev.state, ev.lcmState, ok
+}
+
+// Run keeps the subscription alive (reconnecting with backoff) until stop is closed.
+func (et *EventTracker) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := et.minBackoff
+	for {
+		err := et.subscribe(ctx, func() { backoff = et.minBackoff })
+		et.setConnected(false)
+		if ctx.Err() != nil {
+			return
+		}
+		klog.Warningf("events subscription to %s lost, falling back to polling: %v", et.endpoint, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > et.maxBackoff {
+			backoff = et.maxBackoff
+		}
+	}
+}
+
+func (et *EventTracker) subscribe(ctx context.Context, onConnected func()) error {
+	sub := zmq4.NewSub(ctx)
+	defer sub.Close()
+
+	if err := sub.Dial(et.endpoint); err != nil {
+		return err
+	}
+	if err := sub.SetOption(zmq4.OptionSubscribe, vmStateEventPrefix); err != nil {
+		return err
+	}
+
+	et.setConnected(true)
+	onConnected()
+	klog.Infof("events subscription to %s established", et.endpoint)
+
+	for {
+		msg, err := sub.Recv()
+		if err != nil {
+			return err
+		}
+		if len(msg.Frames) == 0 {
+			continue
+		}
+		vmID, ev, err := parseVMStateEvent(string(msg.Frames[0]))
+		if err != nil {
+			klog.V(4).Info(err)
+			continue
+		}
+		et.mu.Lock()
+		et.states[vmID] = ev
+		if ev.state == goca_vm.Done {
+			et.done[vmID] = time.Now()
+		} else {
+			delete(et.done, vmID)
+		}
+		et.forgetDone(time.Now())
+		et.mu.Unlock()
+	}
+}
+
+// forgetDone drops VMs that reached DONE a while ago, otherwise states would grow with every VM ever seen.
+// NOTE: DONE is kept for doneRetention, so cached (inventory) states can not bring such VMs back meanwhile.
+func (et *EventTracker) forgetDone(now time.Time) {
+	for vmID, at := range et.done {
+		if now.Sub(at) >= et.doneRetention {
+			delete(et.states, vmID)
+			delete(et.done, vmID)
+		}
+	}
+}
+
+func (et *EventTracker) setConnected(connected bool) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	// NOTE: Events may have been missed while disconnected, start over.
+	if connected != et.connected {
+		et.states = map[int]vmStateEvent{}
+		et.done = map[int]time.Time{}
+	}
+	et.connected = connected
+}
+
+// parseVMStateEvent parses keys like "EVENT VM 12/POWEROFF/LCM_INIT".
+func parseVMStateEvent(key string) (int, vmStateEvent, error) {
+	if !strings.HasPrefix(key, vmStateEventPrefix) {
+		return -1, vmStateEvent{}, fmt.Errorf("unexpected event: %s", key)
+	}
+	t := strings.Split(strings.TrimPrefix(key, vmStateEventPrefix), "/")
+	if len(t) != 3 {
+		return -1, vmStateEvent{}, fmt.Errorf("unexpected event: %s", key)
+	}
+	vmID, err := strconv.Atoi(t[0])
+	if err != nil {
+		return -1, vmStateEvent{}, fmt.Errorf("unexpected event: %s", key)
+	}
+	state, ok := vmStatesByEventName[t[1]]
+	if !ok {
+		return -1, vmStateEvent{}, fmt.Errorf("unexpected VM state: %s", key)
+	}
+	lcmState, ok := vmLCMStatesByEventName[t[2]]
+	if !ok {
+		return -1, vmStateEvent{}, fmt.Errorf("unexpected VM LCM state: %s", key)
+	}
+	return vmID, vmStateEvent{state: state, lcmState: lcmState}, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/stretchr/testify/assert"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+func TestParseVMStateEvent(t *testing.T) {
+	vmID, ev, err := parseVMStateEvent("EVENT VM 12/ACTIVE/BOOT_FAILURE")
+	assert.Nil(t, err)
+	assert.Equal(t, 12, vmID)
+	assert.Equal(t, goca_vm.Active, ev.state)
+	assert.Equal(t, goca_vm.BootFailure, ev.lcmState)
+
+	vmID, ev, err = parseVMStateEvent("EVENT VM 13/CLONING_FAILURE/LCM_INIT")
+	assert.Nil(t, err)
+	assert.Equal(t, 13, vmID)
+	assert.Equal(t, goca_vm.CloningFailure, ev.state)
+	assert.Equal(t, goca_vm.LcmInit, ev.lcmState)
+
+	_, ev, err = parseVMStateEvent("EVENT VM 14/ACTIVE/PROLOG_MIGRATE_UNKNOWN_FAILURE")
+	assert.Nil(t, err)
+	assert.Equal(t, goca_vm.PrologMigrateUnknownFailure, ev.lcmState)
+
+	for _, key := range []string{
+		"EVENT VM 12/CLONINGFAILURE/LCM_INIT",
+		"EVENT STATE VM/POWEROFF/LCM_INIT",
+		"EVENT VM 12/POWEROFF",
+		"EVENT VM x/POWEROFF/LCM_INIT",
+		"EVENT VM 12/ASD/LCM_INIT",
+		"EVENT VM 12/POWEROFF/ASD",
+	} {
+		_, _, err := parseVMStateEvent(key)
+		assert.NotNil(t, err, key)
+	}
+}
+
+func TestEventTracker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pub := zmq4.NewPub(ctx)
+	defer pub.Close()
+	if err := pub.Listen("tcp://127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	et, err := NewEventTracker(ONEEvents{Endpoint: fmt.Sprintf("tcp://%s", pub.Addr())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go et.Run(stop)
+
+	publish := func(key string) {
+		_ = pub.Send(zmq4.NewMsgFrom([]byte(key), []byte("PEhPT0tfTUVTU0FHRS8+")))
+	}
+
+	// NOTE: Subscriptions are propagated asynchronously, keep publishing until they are.
+	assert.Eventually(t, func() bool {
+		publish("EVENT VM 7/POWEROFF/LCM_INIT")
+		state, _, ok := et.State(7)
+		return ok && state == goca_vm.Poweroff
+	}, 10*time.Second, 50*time.Millisecond)
+
+	publish("EVENT VM 7/DONE/LCM_INIT")
+	assert.Eventually(t, func() bool {
+		state, _, ok := et.State(7)
+		return ok && state == goca_vm.Done
+	}, 10*time.Second, 50*time.Millisecond)
+
+	_, _, ok := et.State(8)
+	assert.False(t, ok)
+}
+
+func TestEventTrackerForgetDone(t *testing.T) {
+	et, err := NewEventTracker(ONEEvents{Endpoint: "tcp://127.0.0.1:2101"})
+	assert.Nil(t, err)
+	et.connected = true
+
+	now := time.Now()
+	et.states[7] = vmStateEvent{state: goca_vm.Done, lcmState: goca_vm.LcmInit}
+	et.done[7] = now.Add(-et.doneRetention)
+	et.states[8] = vmStateEvent{state: goca_vm.Done, lcmState: goca_vm.LcmInit}
+	et.done[8] = now
+	et.states[9] = vmStateEvent{state: goca_vm.Active, lcmState: goca_vm.Running}
+
+	et.forgetDone(now)
+	_, _, ok := et.State(7)
+	assert.False(t, ok)
+	state, _, ok := et.State(8)
+	assert.True(t, ok)
+	assert.Equal(t, goca_vm.Done, state)
+	_, _, ok = et.State(9)
+	assert.True(t, ok)
+	assert.Len(t, et.done, 1)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"time"
+
+	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
+)
+
+var (
+	methodNameRe  = regexp.MustCompile(`<methodName>([^<]+)</methodName>`)
+	stringParamRe = regexp.MustCompile(`<string>([^<]*)</string>`)
+)
+
+// fakeONe is a minimal XML-RPC stand-in for oned, it answers each method with a canned body.
+type fakeONe struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	responses   map[string]string
+	calls       map[string]int
+	requests    map[string][]byte
+	delay       time.Duration // how long each call takes, to make concurrent callers overlap
+	inFlight    int
+	maxInFlight int
+}
+
+func newFakeONe(responses map[string]string) *fakeONe {
+	f := &fakeONe{
+		responses: responses,
+		calls:     map[string]int{},
+		requests:  map[string][]byte{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+func (f *fakeONe) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	req, _ := io.ReadAll(r.Body)
+	m := methodNameRe.FindSubmatch(req)
+	if m == nil {
+		http.Error(w, "no methodName", http.StatusBadRequest)
+		return
+	}
+	method := string(m[1])
+
+	f.mu.Lock()
+	f.calls[method]++
+	f.requests[method] = req
+	body, ok := f.responses[method]
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	delay := f.delay
+	f.mu.Unlock()
+
+	time.Sleep(delay)
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+
+	status, code := 1, 0
+	if !ok {
+		status, code, body = 0, 0x0400, fmt.Sprintf("[%s] not found", method)
+	}
+	escaped := &bytes.Buffer{}
+	xml.EscapeText(escaped, []byte(body))
+
+	fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value><array><data>`+
+		`<value><boolean>%d</boolean></value><value><string>%s</string></value><value><i4>%d</i4></value>`+
+		`</data></array></value></param></params></methodResponse>`, status, escaped.String(), code)
+}
+
+func (f *fakeONe) setResponse(method, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[method] = body
+}
+
+func (f *fakeONe) callCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// concurrentCalls returns the highest number of calls oned was serving at the same time.
+func (f *fakeONe) concurrentCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.maxInFlight
+}
+
+// stringParams returns the string parameters of the last call of the method (the session string first).
+func (f *fakeONe) stringParams(method string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	params := []string{}
+	for _, m := range stringParamRe.FindAllSubmatch(f.requests[method], -1) {
+		unescaped := struct {
+			V string `xml:",chardata"`
+		}{}
+		if err := xml.Unmarshal(append(append([]byte("<v>"), m[1]...), "</v>"...), &unescaped); err == nil {
+			params = append(params, unescaped.V)
+		}
+	}
+	return params
+}
+
+func (f *fakeONe) controller() *goca.Controller {
+	return goca.NewController(goca.NewDefaultClient(goca.OneConfig{
+		Endpoint: f.URL,
+		Token:    "oneadmin:test",
+	}))
+}
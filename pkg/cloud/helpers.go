@@ -17,13 +17,62 @@ limitations under the License.
 package opennebula
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"unsafe"
 
 	goca_dyn "github.com/OpenNebula/one/src/oca/go/src/goca/dynamic"
+	goca_errors "github.com/OpenNebula/one/src/oca/go/src/goca/errors"
 	goca_vr "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/virtualrouter"
 	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
 )
 
+const (
+	providerIDPrefix string = "one://"
+)
+
+// parseProviderID accepts one://<id> (set by InstancesV2) and opennebula://<id>,
+// which is what cloudprovider.GetInstanceProviderID builds from the legacy Instances.InstanceID.
+func parseProviderID(providerID string) (int, error) {
+	var id string
+	switch {
+	case strings.HasPrefix(providerID, providerIDPrefix):
+		id = strings.TrimPrefix(providerID, providerIDPrefix)
+	case strings.HasPrefix(providerID, ProviderName+"://"):
+		id = strings.TrimPrefix(providerID, ProviderName+"://")
+	default:
+		return -1, fmt.Errorf("unexpected providerID: %s", providerID)
+	}
+	vmID, err := strconv.Atoi(id)
+	if err != nil || vmID < 0 {
+		return -1, fmt.Errorf("unexpected providerID: %s", providerID)
+	}
+	return vmID, nil
+}
+
+func isNotFound(err error) bool {
+	var oneErr *goca_errors.ResponseError
+	return errors.As(err, &oneErr) && oneErr.Code == goca_errors.OneNoExistsError
+}
+
+// sanitizeLabelValue makes s usable as a Kubernetes label value (at most 63 alphanumerics, '-', '_' or '.').
+func sanitizeLabelValue(s string) string {
+	b := []byte(strings.TrimSpace(s))
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			b[i] = '_'
+		}
+	}
+	if len(b) > 63 {
+		b = b[:63]
+	}
+	return strings.Trim(string(b), "-_.")
+}
+
 func ensureNIC(maybeTemplate interface{}, index int) *goca_dyn.Vector {
 	if index < 0 {
 		return nil
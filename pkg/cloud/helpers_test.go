@@ -0,0 +1,38 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProviderID(t *testing.T) {
+	vmID, err := parseProviderID("one://123")
+	assert.Nil(t, err)
+	assert.Equal(t, 123, vmID)
+
+	vmID, err = parseProviderID("opennebula://123")
+	assert.Nil(t, err)
+	assert.Equal(t, 123, vmID)
+
+	for _, providerID := range []string{"", "one://", "one://-1", "one://abc", "opennebula://", "aws://123", "123"} {
+		_, err := parseProviderID(providerID)
+		assert.NotNil(t, err, providerID)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const (
+	hostLabel      = "opennebula.io/host"
+	hostIDLabel    = "opennebula.io/host-id"
+	clusterLabel   = "opennebula.io/cluster"
+	clusterIDLabel = "opennebula.io/cluster-id"
+
+	defaultHostLabelsSyncInterval = 1 * time.Minute
+)
+
+var hostLabelKeys = []string{hostLabel, hostIDLabel, clusterLabel, clusterIDLabel}
+
+// hostLabels returns the identity of the hypervisor host (and its cluster) the VM currently runs on.
+func (i2 *InstancesV2) hostLabels(ctx context.Context, vm *goca_vm.VM) (map[string]string, error) {
+	history := lastHistory(vm)
+	if history == nil {
+		return nil, nil
+	}
+	clusterName, err := i2.topology.clusterName(ctx, history.CID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		hostLabel:      sanitizeLabelValue(history.Hostname),
+		hostIDLabel:    strconv.Itoa(history.HID),
+		clusterLabel:   clusterName,
+		clusterIDLabel: strconv.Itoa(history.CID),
+	}, nil
+}
+
+// HostLabeler keeps host labels of initialized nodes up to date, since the cloud-node controller
+// applies InstanceMetadata labels only once and VMs may be (live) migrated afterwards.
+type HostLabeler struct {
+	instancesV2 *InstancesV2
+	client      clientset.Interface
+	interval    time.Duration
+}
+
+func NewHostLabeler(instancesV2 *InstancesV2, client clientset.Interface, cfg ONEHostLabels) *HostLabeler {
+	interval := defaultHostLabelsSyncInterval
+	if cfg.SyncInterval != nil {
+		interval = *cfg.SyncInterval
+	}
+	return &HostLabeler{
+		instancesV2: instancesV2,
+		client:      client,
+		interval:    interval,
+	}
+}
+
+func (hl *HostLabeler) Run(stop <-chan struct{}) {
+	wait.UntilWithContext(wait.ContextForChannel(stop), func(ctx context.Context) {
+		if err := hl.sync(ctx); err != nil {
+			klog.Errorf("host labels sync failed: %v", err)
+		}
+	}, hl.interval)
+}
+
+func (hl *HostLabeler) sync(ctx context.Context) error {
+	nodes, err := hl.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for idx := range nodes.Items {
+		if err := hl.syncNode(ctx, &nodes.Items[idx]); err != nil {
+			klog.Errorf("host labels sync of node %s failed: %v", nodes.Items[idx].Name, err)
+		}
+	}
+	return nil
+}
+
+func (hl *HostLabeler) syncNode(ctx context.Context, node *corev1.Node) error {
+	// NOTE: Uninitialized nodes get their labels from InstanceMetadata.
+	if len(node.Spec.ProviderID) == 0 {
+		return nil
+	}
+	vm, err := hl.instancesV2.byNode(ctx, node)
+	if err != nil || vm == nil {
+		return err
+	}
+	expected, err := hl.instancesV2.hostLabels(ctx, vm)
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]*string{}
+	for _, k := range hostLabelKeys {
+		v, ok := expected[k]
+		current, exists := node.Labels[k]
+		switch {
+		case ok && (!exists || current != v):
+			labels[k] = &v
+		case !ok && exists:
+			labels[k] = nil
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": labels}})
+	if err != nil {
+		return err
+	}
+	if _, err := hl.client.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	klog.Infof("updated host labels of node %s (VM %d)", node.Name, vm.ID)
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHostLabeler(t *testing.T) {
+	one := newTopologyFakeONe()
+	defer one.Close()
+	one.setResponse("one.vm.info", placedVM)
+
+	topology, err := NewTopology(one.controller(), OpenNebulaConfig{})
+	assert.Nil(t, err)
+	lifecycle, err := resolveInstanceLifecycle(OpenNebulaConfig{})
+	assert.Nil(t, err)
+	i2 := &InstancesV2{ctrl: one.controller(), topology: topology, lifecycle: lifecycle}
+
+	expected := map[string]string{
+		hostLabel:      "kvm-b2",
+		hostIDLabel:    "2",
+		clusterLabel:   "rack_b",
+		clusterIDLabel: "101",
+	}
+	labels, err := i2.hostLabels(context.TODO(), mustParseVM(t, placedVM))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, labels)
+
+	// NOTE: Labels from before the live migration (kvm-a1, 100).
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0", Labels: map[string]string{
+			hostLabel:      "kvm-a1",
+			hostIDLabel:    "1",
+			clusterLabel:   "rack_a",
+			clusterIDLabel: "100",
+			"role":         "worker",
+		}},
+		Spec: corev1.NodeSpec{ProviderID: "one://40"},
+	}, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+	})
+	hl := NewHostLabeler(i2, client, ONEHostLabels{})
+	assert.Nil(t, hl.sync(context.TODO()))
+
+	node, err := client.CoreV1().Nodes().Get(context.TODO(), "node0", metav1.GetOptions{})
+	assert.Nil(t, err)
+	expected["role"] = "worker"
+	assert.Equal(t, expected, node.Labels)
+
+	node, err = client.CoreV1().Nodes().Get(context.TODO(), "node1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, node.Labels)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
+	cloudnodeutil "k8s.io/cloud-provider/node/helpers"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+
+	goca_host "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/host"
+)
+
+const (
+	HostTaintControllerName  = "host-taint-controller"
+	HostTaintControllerAlias = "host-taint"
+
+	hostUnavailableTaintKey = "opennebula.io/host-unavailable"
+
+	defaultHostTaintSyncInterval = 1 * time.Minute
+)
+
+var unavailableHostStates = map[goca_host.State]struct{}{
+	goca_host.State(goca_host.Error):              {},
+	goca_host.State(goca_host.MonitoringError):    {},
+	goca_host.State(goca_host.Disabled):           {},
+	goca_host.State(goca_host.MonitoringDisabled): {},
+	goca_host.State(goca_host.Offline):            {},
+}
+
+// StartHostTaintControllerWrapper is used to register HostTaintController in app.DefaultInitFuncConstructors.
+func StartHostTaintControllerWrapper(initContext app.ControllerInitContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+	return func(ctx context.Context, _ genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		one, ok := cloud.(*OpenNebula)
+		if !ok || one.instancesV2.Disabled {
+			klog.Infof("InstancesV2 disabled, will not taint nodes on unavailable hosts")
+			return nil, false, nil
+		}
+		c, err := NewHostTaintController(
+			one.instancesV2,
+			completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName),
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			one.hostTaint,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		go c.Run(ctx)
+		return nil, true, nil
+	}
+}
+
+// HostTaintController taints nodes running on hypervisor hosts that are disabled, offline or in error,
+// so workloads can be drained before (planned) host maintenance, and removes the taint once the host is back.
+type HostTaintController struct {
+	instancesV2 *InstancesV2
+	client      clientset.Interface
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	effect      corev1.TaintEffect
+	interval    time.Duration
+}
+
+func NewHostTaintController(instancesV2 *InstancesV2, client clientset.Interface, nodeInformer coreinformers.NodeInformer, cfg ONEHostTaint) (*HostTaintController, error) {
+	effect := corev1.TaintEffectNoSchedule
+	if len(cfg.Effect) > 0 {
+		effect = corev1.TaintEffect(cfg.Effect)
+	}
+	switch effect {
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+	default:
+		return nil, fmt.Errorf("unexpected hostTaint effect: %s", effect)
+	}
+	interval := defaultHostTaintSyncInterval
+	if cfg.SyncInterval != nil {
+		interval = *cfg.SyncInterval
+	}
+	return &HostTaintController{
+		instancesV2: instancesV2,
+		client:      client,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		effect:      effect,
+		interval:    interval,
+	}, nil
+}
+
+func (c *HostTaintController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+
+	klog.Infof("starting %s", HostTaintControllerName)
+	defer klog.Infof("shutting down %s", HostTaintControllerName)
+
+	if !cache.WaitForNamedCacheSync(HostTaintControllerName, ctx.Done(), c.nodesSynced) {
+		return
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.sync(ctx); err != nil {
+			klog.Errorf("host taints sync failed: %v", err)
+		}
+	}, c.interval)
+}
+
+func (c *HostTaintController) sync(ctx context.Context) error {
+	pool, err := c.instancesV2.ctrl.Hosts().InfoContext(ctx)
+	if err != nil {
+		return err
+	}
+	hostStates := make(map[int]goca_host.State, len(pool.Hosts))
+	for _, host := range pool.Hosts {
+		hostStates[host.ID] = goca_host.State(host.StateRaw)
+	}
+
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err := c.syncNode(ctx, node, hostStates); err != nil {
+			klog.Errorf("host taint sync of node %s failed: %v", node.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *HostTaintController) syncNode(ctx context.Context, node *corev1.Node, hostStates map[int]goca_host.State) error {
+	// NOTE: Uninitialized nodes are handled by the cloud-node controller first.
+	if len(node.Spec.ProviderID) == 0 {
+		return nil
+	}
+	vm, err := c.instancesV2.byNode(ctx, node)
+	if err != nil || vm == nil {
+		return err
+	}
+
+	var expected *corev1.Taint
+	if history := lastHistory(vm); history != nil {
+		if state, ok := hostStates[history.HID]; ok {
+			if _, unavailable := unavailableHostStates[state]; unavailable {
+				expected = &corev1.Taint{Key: hostUnavailableTaintKey, Value: state.String(), Effect: c.effect}
+			}
+		}
+	}
+
+	var current *corev1.Taint
+	for i := range node.Spec.Taints {
+		if node.Spec.Taints[i].Key == hostUnavailableTaintKey {
+			current = &node.Spec.Taints[i]
+			break
+		}
+	}
+
+	switch {
+	case expected != nil && (current == nil || current.Value != expected.Value || current.Effect != expected.Effect):
+		klog.Infof("tainting node %s, host %s is %s", node.Name, lastHistory(vm).Hostname, expected.Value)
+		return cloudnodeutil.AddOrUpdateTaintOnNode(c.client, node.Name, expected)
+	case expected == nil && current != nil:
+		klog.Infof("removing host taint from node %s", node.Name)
+		return cloudnodeutil.RemoveTaintOffNode(c.client, node.Name, node, current)
+	}
+	return nil
+}
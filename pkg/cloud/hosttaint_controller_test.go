@@ -0,0 +1,72 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	goca_host "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/host"
+)
+
+func TestHostTaintController(t *testing.T) {
+	one := newFakeONe(map[string]string{
+		"one.vm.info":       placedVM,
+		"one.hostpool.info": `<HOST_POOL><HOST><ID>2</ID><NAME>kvm-b2</NAME><STATE>4</STATE><TEMPLATE></TEMPLATE></HOST></HOST_POOL>`,
+	})
+	defer one.Close()
+
+	lifecycle, err := resolveInstanceLifecycle(OpenNebulaConfig{})
+	assert.Nil(t, err)
+	i2 := &InstancesV2{ctrl: one.controller(), lifecycle: lifecycle}
+
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+		Spec:       corev1.NodeSpec{ProviderID: "one://40"},
+	})
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c, err := NewHostTaintController(i2, client, informerFactory.Core().V1().Nodes(), ONEHostTaint{})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+
+	assert.Nil(t, c.sync(ctx))
+	node, err := client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, node.Spec.Taints, 1)
+	assert.Equal(t, hostUnavailableTaintKey, node.Spec.Taints[0].Key)
+	assert.Equal(t, "DISABLED", node.Spec.Taints[0].Value)
+	assert.Equal(t, corev1.TaintEffectNoSchedule, node.Spec.Taints[0].Effect)
+
+	assert.Nil(t, c.syncNode(ctx, node, map[int]goca_host.State{2: goca_host.State(goca_host.Monitored)}))
+	node, err = client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, node.Spec.Taints)
+
+	_, err = NewHostTaintController(i2, client, informerFactory.Core().V1().Nodes(), ONEHostTaint{Effect: "Evict"})
+	assert.NotNil(t, err)
+}
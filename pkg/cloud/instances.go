@@ -0,0 +1,129 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+// Instances implements the legacy Instances interface on top of InstancesV2 lookups.
+type Instances struct {
+	instancesV2 *InstancesV2
+}
+
+func NewInstances(instancesV2 *InstancesV2) *Instances {
+	return &Instances{
+		instancesV2: instancesV2,
+	}
+}
+
+func (i *Instances) NodeAddresses(ctx context.Context, nodeName types.NodeName) ([]corev1.NodeAddress, error) {
+	vm, err := i.byNodeName(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return i.instancesV2.nodeAddresses(vm)
+}
+
+func (i *Instances) NodeAddressesByProviderID(ctx context.Context, providerID string) ([]corev1.NodeAddress, error) {
+	vm, err := i.byProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return i.instancesV2.nodeAddresses(vm)
+}
+
+// InstanceID returns the VM ID, cloudprovider.GetInstanceProviderID builds opennebula://<id> from it.
+func (i *Instances) InstanceID(ctx context.Context, nodeName types.NodeName) (string, error) {
+	vm, err := i.byNodeName(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(vm.ID), nil
+}
+
+func (i *Instances) InstanceType(ctx context.Context, nodeName types.NodeName) (string, error) {
+	vm, err := i.byNodeName(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+	return i.instancesV2.instanceType(ctx, vm)
+}
+
+func (i *Instances) InstanceTypeByProviderID(ctx context.Context, providerID string) (string, error) {
+	vm, err := i.byProviderID(ctx, providerID)
+	if err != nil {
+		return "", err
+	}
+	return i.instancesV2.instanceType(ctx, vm)
+}
+
+func (i *Instances) AddSSHKeyToAllInstances(_ context.Context, _ string, _ []byte) error {
+	return cloudprovider.NotImplemented
+}
+
+func (i *Instances) CurrentNodeName(_ context.Context, hostname string) (types.NodeName, error) {
+	return types.NodeName(hostname), nil
+}
+
+func (i *Instances) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	vm, err := i.byProviderID(ctx, providerID)
+	if err == cloudprovider.InstanceNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return vm != nil, nil
+}
+
+func (i *Instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	vm, err := i.byProviderID(ctx, providerID)
+	if err != nil {
+		return false, err
+	}
+	return i.instancesV2.lifecycle.shutdown.contains(vm), nil
+}
+
+func (i *Instances) byNodeName(ctx context.Context, nodeName types.NodeName) (*goca_vm.VM, error) {
+	vm, err := i.instancesV2.byNodeName(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	if vm == nil {
+		return nil, cloudprovider.InstanceNotFound
+	}
+	return vm, nil
+}
+
+func (i *Instances) byProviderID(ctx context.Context, providerID string) (*goca_vm.VM, error) {
+	vm, err := i.instancesV2.byProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	if vm == nil {
+		return nil, cloudprovider.InstanceNotFound
+	}
+	return vm, nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestInstances(t *testing.T) {
+	one := newFakeONe(map[string]string{"one.vm.info": dualStackVM})
+	defer one.Close()
+
+	i2, err := NewInstancesV2(OpenNebulaConfig{
+		Endpoint:       OpenNebulaEndpoint{ONE_XMLRPC: one.URL, ONE_AUTH: "oneadmin:test"},
+		PrivateNetwork: &ONEVirtualNetwork{Name: "private"},
+		PublicNetwork:  &ONEVirtualNetwork{Name: "service"},
+	})
+	assert.Nil(t, err)
+	i2.client = fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+		Spec:       corev1.NodeSpec{ProviderID: "one://20"},
+	})
+	instances := NewInstances(i2)
+
+	instanceID, err := instances.InstanceID(context.TODO(), "node0")
+	assert.Nil(t, err)
+	assert.Equal(t, "20", instanceID)
+
+	providerID, err := cloudprovider.GetInstanceProviderID(context.TODO(), &OpenNebula{instancesV2: i2, instances: instances}, "node0")
+	assert.Nil(t, err)
+	assert.Equal(t, "opennebula://20", providerID)
+	exists, err := instances.InstanceExistsByProviderID(context.TODO(), providerID)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	nodeAddresses, err := instances.NodeAddressesByProviderID(context.TODO(), "one://20")
+	assert.Nil(t, err)
+	assert.Contains(t, nodeAddresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "10.2.11.102"})
+
+	nodeAddresses, err = instances.NodeAddresses(context.TODO(), "node0")
+	assert.Nil(t, err)
+	assert.Contains(t, nodeAddresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "172.20.0.102"})
+
+	exists, err = instances.InstanceExistsByProviderID(context.TODO(), "one://20")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	_, err = instances.InstanceExistsByProviderID(context.TODO(), "aws://20")
+	assert.NotNil(t, err)
+
+	_, err = instances.InstanceID(context.TODO(), "node1")
+	assert.NotNil(t, err)
+
+	one.setResponse("one.vm.info", `<VM><ID>20</ID><NAME>node0</NAME><STATE>8</STATE><LCM_STATE>0</LCM_STATE><TEMPLATE></TEMPLATE></VM>`)
+	shutdown, err := instances.InstanceShutdownByProviderID(context.TODO(), "one://20")
+	assert.Nil(t, err)
+	assert.True(t, shutdown)
+
+	one.setResponse("one.vm.info", `<VM><ID>20</ID><NAME>node0</NAME><STATE>6</STATE><LCM_STATE>0</LCM_STATE><TEMPLATE></TEMPLATE></VM>`)
+	exists, err = instances.InstanceExistsByProviderID(context.TODO(), "one://20")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	_, err = instances.InstanceShutdownByProviderID(context.TODO(), "one://20")
+	assert.Equal(t, cloudprovider.InstanceNotFound, err)
+}
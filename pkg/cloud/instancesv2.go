@@ -21,6 +21,9 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
 	cloudprovider "k8s.io/cloud-provider"
 
 	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
@@ -28,8 +31,18 @@ import (
 )
 
 type InstancesV2 struct {
-	Disabled bool
-	ctrl     *goca.Controller
+	Disabled        bool
+	ctrl            *goca.Controller
+	inventory       *Inventory
+	events          *EventTracker
+	nodeAddressing  ONENodeAddresses
+	instanceTypeCfg *ONEInstanceType
+	topology        *Topology
+	lifecycle       *instanceLifecycle
+	nodeLabels      *ONENodeLabels
+	hostLabelsCfg   ONEHostLabels
+	scope           ONEInstanceScope
+	client          clientset.Interface // set in Initialize, used by the legacy interfaces to resolve node names
 }
 
 func NewInstancesV2(cfg OpenNebulaConfig) (*InstancesV2, error) {
@@ -37,9 +50,48 @@ func NewInstancesV2(cfg OpenNebulaConfig) (*InstancesV2, error) {
 		Endpoint: cfg.Endpoint.ONE_XMLRPC,
 		Token:    cfg.Endpoint.ONE_AUTH,
 	}))
+	nodeAddressing, err := resolveNodeAddresses(cfg)
+	if err != nil {
+		return nil, err
+	}
+	instanceTypeCfg, err := resolveInstanceType(cfg)
+	if err != nil {
+		return nil, err
+	}
+	topology, err := NewTopology(ctrl, cfg)
+	if err != nil {
+		return nil, err
+	}
+	lifecycle, err := resolveInstanceLifecycle(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hostLabelsCfg := ONEHostLabels{}
+	if cfg.HostLabels != nil {
+		hostLabelsCfg = *cfg.HostLabels
+	}
+	var inventory *Inventory
+	if cfg.Inventory != nil {
+		inventory = NewInventory(ctrl, *cfg.Inventory)
+	}
+	var events *EventTracker
+	if cfg.Events != nil {
+		if events, err = NewEventTracker(*cfg.Events); err != nil {
+			return nil, err
+		}
+	}
 	return &InstancesV2{
-		Disabled: false,
-		ctrl:     ctrl,
+		Disabled:        false,
+		ctrl:            ctrl,
+		inventory:       inventory,
+		events:          events,
+		nodeAddressing:  nodeAddressing,
+		instanceTypeCfg: instanceTypeCfg,
+		topology:        topology,
+		lifecycle:       lifecycle,
+		nodeLabels:      resolveNodeLabels(cfg),
+		hostLabelsCfg:   hostLabelsCfg,
+		scope:           resolveInstanceScope(cfg),
 	}, nil
 }
 
@@ -47,7 +99,7 @@ func (i2 *InstancesV2) InstanceExists(ctx context.Context, node *corev1.Node) (b
 	if i2.Disabled {
 		return false, fmt.Errorf("InstancesV2 disabled")
 	}
-	vm, err := i2.byUUID(ctx, node.Status.NodeInfo.SystemUUID)
+	vm, err := i2.byNode(ctx, node)
 	if err != nil {
 		return false, err
 	}
@@ -58,32 +110,21 @@ func (i2 *InstancesV2) InstanceShutdown(ctx context.Context, node *corev1.Node)
 	if i2.Disabled {
 		return false, fmt.Errorf("InstancesV2 disabled")
 	}
-	vm, err := i2.byUUID(ctx, node.Status.NodeInfo.SystemUUID)
+	vm, err := i2.byNode(ctx, node)
 	if err != nil {
 		return false, err
 	}
 	if vm == nil {
 		return false, fmt.Errorf("instance not found")
 	}
-
-	state, _, err := vm.State()
-	if err != nil {
-		return false, err
-	}
-
-	switch state {
-	case goca_vm.Poweroff, goca_vm.Undeployed:
-		return true, nil
-	default:
-		return false, nil
-	}
+	return i2.lifecycle.shutdown.contains(vm), nil
 }
 
 func (i2 *InstancesV2) InstanceMetadata(ctx context.Context, node *corev1.Node) (*cloudprovider.InstanceMetadata, error) {
 	if i2.Disabled {
 		return nil, fmt.Errorf("InstancesV2 disabled")
 	}
-	vm, err := i2.byUUID(ctx, node.Status.NodeInfo.SystemUUID)
+	vm, err := i2.byNode(ctx, node)
 	if err != nil {
 		return nil, err
 	}
@@ -91,44 +132,168 @@ func (i2 *InstancesV2) InstanceMetadata(ctx context.Context, node *corev1.Node)
 		return nil, fmt.Errorf("instance not found")
 	}
 
-	address4, err := vm.Template.GetStrFromVec("CONTEXT", "ETH0_IP")
+	nodeAddresses, err := i2.nodeAddresses(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceType, err := i2.instanceType(ctx, vm)
+	if err != nil {
+		return nil, err
+	}
+
+	zone, err := i2.topology.Zone(ctx, vm)
 	if err != nil {
 		return nil, err
 	}
 
-	nodeAddresses := []corev1.NodeAddress{
-		corev1.NodeAddress{
-			Type:    corev1.NodeInternalIP,
-			Address: address4,
-		},
-		corev1.NodeAddress{
-			Type:    corev1.NodeExternalIP,
-			Address: address4,
-		},
+	additionalLabels, err := i2.additionalLabels(ctx, vm)
+	if err != nil {
+		return nil, err
 	}
 
 	return &cloudprovider.InstanceMetadata{
-		ProviderID:    fmt.Sprintf("one://%d", vm.ID),
-		NodeAddresses: nodeAddresses,
-		InstanceType:  "",
-		Zone:          "",
-		Region:        "",
+		ProviderID:       fmt.Sprintf("%s%d", providerIDPrefix, vm.ID),
+		NodeAddresses:    nodeAddresses,
+		InstanceType:     instanceType,
+		Zone:             zone.FailureDomain,
+		Region:           zone.Region,
+		AdditionalLabels: additionalLabels,
 	}, nil
 }
 
-func (i2 *InstancesV2) byUUID(ctx context.Context, vmUUID string) (*goca_vm.VM, error) {
-	pool, err := i2.ctrl.VMs().InfoExtendedContext(ctx, -2)
+func (i2 *InstancesV2) byNodeName(ctx context.Context, nodeName types.NodeName) (*goca_vm.VM, error) {
+	if i2.client == nil {
+		return nil, fmt.Errorf("InstancesV2 not initialized")
+	}
+	node, err := i2.client.CoreV1().Nodes().Get(ctx, string(nodeName), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return i2.byNode(ctx, node)
+}
+
+func (i2 *InstancesV2) byNode(ctx context.Context, node *corev1.Node) (*goca_vm.VM, error) {
+	// NOTE: Nodes that have not been initialized yet have no providerID.
+	if len(node.Spec.ProviderID) > 0 {
+		return i2.byProviderID(ctx, node.Spec.ProviderID)
+	}
+	vm, err := i2.byUUID(ctx, node.Status.NodeInfo.SystemUUID)
+	if err != nil {
+		return nil, err
+	}
+	return i2.withLifecycle(vm), nil
+}
+
+func (i2 *InstancesV2) byProviderID(ctx context.Context, providerID string) (*goca_vm.VM, error) {
+	vmID, err := parseProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+	vm, err := i2.byID(ctx, vmID)
+	if err != nil {
+		return nil, err
+	}
+	return i2.withLifecycle(vm), nil
+}
+
+// withLifecycle applies the tracked state and hides VMs that are gone.
+func (i2 *InstancesV2) withLifecycle(vm *goca_vm.VM) *goca_vm.VM {
+	if vm = i2.withTrackedState(vm); vm != nil && i2.lifecycle.gone.contains(vm) {
+		return nil
+	}
+	return vm
+}
+
+// withTrackedState overrides the (possibly cached) VM state with the latest one seen on the event bus.
+func (i2 *InstancesV2) withTrackedState(vm *goca_vm.VM) *goca_vm.VM {
+	if vm == nil || i2.events == nil {
+		return vm
+	}
+	state, lcmState, ok := i2.events.State(vm.ID)
+	if !ok {
+		return vm
+	}
+	tracked := *vm
+	tracked.StateRaw, tracked.LCMStateRaw = int(state), int(lcmState)
+	return &tracked
+}
+
+func (i2 *InstancesV2) byID(ctx context.Context, vmID int) (*goca_vm.VM, error) {
+	if i2.inventory != nil {
+		vm, ok, err := i2.inventory.ByID(ctx, vmID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if i2.lifecycle.gone.contains(vm) {
+				return nil, nil
+			}
+			return vm, nil
+		}
+	}
+	vm, err := i2.ctrl.VM(vmID).InfoContext(ctx, false)
 	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	for _, vm := range pool.VMs {
-		osUUID, err := vm.Template.GetStrFromVec("OS", "UUID")
+	// NOTE: Terminated VMs are kept in the database, but pool queries skip them.
+	if i2.lifecycle.gone.contains(vm) {
+		return nil, nil
+	}
+	return vm, nil
+}
+
+// byUUID returns the only VM in scope with the given OS/UUID, cloned images or restored backups
+// may share it across clusters, so ambiguous matches are reported as an error.
+func (i2 *InstancesV2) byUUID(ctx context.Context, vmUUID string) (*goca_vm.VM, error) {
+	var candidates []*goca_vm.VM
+	cached := false
+	if i2.inventory != nil {
+		vms, ok, err := i2.inventory.ByUUID(ctx, vmUUID)
+		if err != nil {
+			return nil, err
+		}
+		candidates, cached = vms, ok
+	}
+	if !cached {
+		filter := goca.NewVMFilterDefault()
+		if err := filter.SetPair("VM.TEMPLATE.OS.UUID", vmUUID); err != nil {
+			return nil, err
+		}
+		pool, err := i2.ctrl.VMs().InfoExtendedFilterContext(ctx, filter)
 		if err != nil {
 			return nil, err
 		}
-		if vmUUID == osUUID {
-			return &vm, nil
+		for idx := range pool.VMs {
+			osUUID, err := pool.VMs[idx].Template.GetStrFromVec("OS", "UUID")
+			if err != nil {
+				return nil, err
+			}
+			if vmUUID == osUUID {
+				candidates = append(candidates, &pool.VMs[idx])
+			}
+		}
+	}
+
+	var matches []*goca_vm.VM
+	for _, vm := range candidates {
+		if i2.scope.contains(vm) {
+			matches = append(matches, vm)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	default:
+		vmIDs := make([]int, len(matches))
+		for idx, vm := range matches {
+			vmIDs[idx] = vm.ID
 		}
+		return nil, fmt.Errorf("ambiguous SystemUUID %s: matches VMs %v, configure instanceScope to narrow it down", vmUUID, vmIDs)
 	}
-	return nil, nil
 }
@@ -0,0 +1,97 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const (
+	instanceTypeSourceTemplate  = "template"
+	instanceTypeSourceAttribute = "attribute"
+	instanceTypeSourceCapacity  = "capacity"
+
+	defaultInstanceTypeAttribute = "K8S_INSTANCE_TYPE"
+)
+
+func resolveInstanceType(cfg OpenNebulaConfig) (*ONEInstanceType, error) {
+	if cfg.InstanceType == nil {
+		return nil, nil
+	}
+	resolved := *cfg.InstanceType
+	switch resolved.Source {
+	case instanceTypeSourceTemplate, instanceTypeSourceCapacity:
+	case instanceTypeSourceAttribute:
+		if len(resolved.Attribute) == 0 {
+			resolved.Attribute = defaultInstanceTypeAttribute
+		}
+	default:
+		return nil, fmt.Errorf("unexpected instanceType source: %s", resolved.Source)
+	}
+	return &resolved, nil
+}
+
+func (i2 *InstancesV2) instanceType(ctx context.Context, vm *goca_vm.VM) (string, error) {
+	if i2.instanceTypeCfg == nil {
+		return "", nil
+	}
+	switch i2.instanceTypeCfg.Source {
+	case instanceTypeSourceTemplate:
+		templateID, err := vm.Template.GetInt("TEMPLATE_ID")
+		if err != nil {
+			return "", nil
+		}
+		template, err := i2.ctrl.Template(templateID).InfoContext(ctx, false, false)
+		if err != nil {
+			if isNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return sanitizeLabelValue(template.Name), nil
+	case instanceTypeSourceAttribute:
+		v, err := vm.UserTemplate.GetStr(i2.instanceTypeCfg.Attribute)
+		if err != nil {
+			return "", nil
+		}
+		return sanitizeLabelValue(v), nil
+	case instanceTypeSourceCapacity:
+		return capacityInstanceType(vm), nil
+	}
+	return "", nil
+}
+
+// capacityInstanceType returns a normalized capacity string like "0.5cpu-2vcpu-4096mb".
+func capacityInstanceType(vm *goca_vm.VM) string {
+	cpu, err := vm.Template.GetCPU()
+	if err != nil {
+		return ""
+	}
+	memory, err := vm.Template.GetMemory()
+	if err != nil {
+		return ""
+	}
+	vcpu, err := vm.Template.GetVCPU()
+	if err != nil {
+		vcpu = 1 // OpenNebula default
+	}
+	return fmt.Sprintf("%scpu-%dvcpu-%dmb", strconv.FormatFloat(cpu, 'f', -1, 64), vcpu, memory)
+}
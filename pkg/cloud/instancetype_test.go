@@ -0,0 +1,54 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sizedVM = `<VM><ID>30</ID><NAME>node0</NAME>
+<TEMPLATE><CPU>0.5</CPU><VCPU>2</VCPU><MEMORY>4096</MEMORY><TEMPLATE_ID>5</TEMPLATE_ID></TEMPLATE>
+<USER_TEMPLATE><K8S_INSTANCE_TYPE>gpu.large</K8S_INSTANCE_TYPE></USER_TEMPLATE>
+</VM>`
+
+func TestInstanceType(t *testing.T) {
+	one := newFakeONe(map[string]string{
+		"one.template.info": `<VMTEMPLATE><ID>5</ID><NAME>Ubuntu 22.04 (4GB)</NAME><TEMPLATE></TEMPLATE></VMTEMPLATE>`,
+	})
+	defer one.Close()
+
+	vm := mustParseVM(t, sizedVM)
+
+	for source, expected := range map[string]string{
+		"template":  "Ubuntu_22.04__4GB",
+		"attribute": "gpu.large",
+		"capacity":  "0.5cpu-2vcpu-4096mb",
+	} {
+		instanceTypeCfg, err := resolveInstanceType(OpenNebulaConfig{InstanceType: &ONEInstanceType{Source: source}})
+		assert.Nil(t, err)
+		i2 := &InstancesV2{ctrl: one.controller(), instanceTypeCfg: instanceTypeCfg}
+		instanceType, err := i2.instanceType(context.TODO(), vm)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, instanceType, source)
+	}
+
+	_, err := resolveInstanceType(OpenNebulaConfig{InstanceType: &ONEInstanceType{Source: "asd"}})
+	assert.NotNil(t, err)
+}
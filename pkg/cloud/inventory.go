@@ -0,0 +1,177 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+
+	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const (
+	defaultInventoryRefreshInterval = 60 * time.Second
+)
+
+var (
+	inventoryHits = metrics.NewCounter(&metrics.CounterOpts{
+		Namespace:      ProviderName,
+		Subsystem:      "inventory",
+		Name:           "cache_hits_total",
+		Help:           "Number of VM lookups answered from the inventory cache.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	inventoryMisses = metrics.NewCounter(&metrics.CounterOpts{
+		Namespace:      ProviderName,
+		Subsystem:      "inventory",
+		Name:           "cache_misses_total",
+		Help:           "Number of VM lookups not found in the inventory cache.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	registerInventoryMetrics sync.Once
+)
+
+// Inventory is an in-memory snapshot of the VM pool, refreshed at most once per interval.
+// It is shared by all controllers using the same InstancesV2, the VMs it returns must be treated as read-only.
+type Inventory struct {
+	ctrl     *goca.Controller
+	interval time.Duration
+
+	mu      sync.RWMutex
+	byID    map[int]*goca_vm.VM
+	byUUID  map[string][]*goca_vm.VM
+	expires time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func NewInventory(ctrl *goca.Controller, cfg ONEInventory) *Inventory {
+	registerInventoryMetrics.Do(func() {
+		legacyregistry.MustRegister(inventoryHits, inventoryMisses)
+	})
+	interval := defaultInventoryRefreshInterval
+	if cfg.RefreshInterval != nil && *cfg.RefreshInterval > 0 {
+		interval = *cfg.RefreshInterval
+	}
+	return &Inventory{
+		ctrl:     ctrl,
+		interval: interval,
+	}
+}
+
+// ByID returns the cached VM and true, or nil and false if the VM is not known.
+func (inv *Inventory) ByID(ctx context.Context, vmID int) (*goca_vm.VM, bool, error) {
+	if err := inv.ensureFresh(ctx); err != nil {
+		return nil, false, err
+	}
+	inv.mu.RLock()
+	vm, ok := inv.byID[vmID]
+	inv.mu.RUnlock()
+	inv.count(ok)
+	return vm, ok, nil
+}
+
+// ByUUID returns all cached VMs sharing the OS/UUID and true, or nil and false if no VM is known.
+func (inv *Inventory) ByUUID(ctx context.Context, vmUUID string) ([]*goca_vm.VM, bool, error) {
+	if err := inv.ensureFresh(ctx); err != nil {
+		return nil, false, err
+	}
+	inv.mu.RLock()
+	vms, ok := inv.byUUID[vmUUID]
+	inv.mu.RUnlock()
+	inv.count(ok)
+	return vms, ok, nil
+}
+
+// VMs returns all cached VMs.
+func (inv *Inventory) VMs(ctx context.Context) ([]*goca_vm.VM, error) {
+	if err := inv.ensureFresh(ctx); err != nil {
+		return nil, err
+	}
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	vms := make([]*goca_vm.VM, 0, len(inv.byID))
+	for _, vm := range inv.byID {
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (inv *Inventory) Stats() (uint64, uint64) {
+	return inv.hits.Load(), inv.misses.Load()
+}
+
+func (inv *Inventory) count(hit bool) {
+	if hit {
+		inv.hits.Add(1)
+		inventoryHits.Inc()
+	} else {
+		inv.misses.Add(1)
+		inventoryMisses.Inc()
+	}
+}
+
+func (inv *Inventory) ensureFresh(ctx context.Context) error {
+	inv.mu.RLock()
+	fresh := time.Now().Before(inv.expires)
+	inv.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	// NOTE: Some other caller may have refreshed it in the meantime.
+	if time.Now().Before(inv.expires) {
+		return nil
+	}
+
+	pool, err := inv.ctrl.VMs().InfoExtendedContext(ctx, -2)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int]*goca_vm.VM, len(pool.VMs))
+	byUUID := make(map[string][]*goca_vm.VM, len(pool.VMs))
+	for i := range pool.VMs {
+		vm := &pool.VMs[i]
+		byID[vm.ID] = vm
+		osUUID, err := vm.Template.GetStrFromVec("OS", "UUID")
+		if err != nil {
+			continue
+		}
+		byUUID[osUUID] = append(byUUID[osUUID], vm)
+	}
+
+	inv.byID, inv.byUUID = byID, byUUID
+	inv.expires = time.Now().Add(inv.interval)
+
+	hits, misses := inv.Stats()
+	klog.V(4).Infof("inventory refreshed: vms=%d hits=%d misses=%d", len(byID), hits, misses)
+
+	return nil
+}
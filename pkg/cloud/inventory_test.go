@@ -0,0 +1,67 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const inventoryPool = `<VM_POOL>
+<VM><ID>10</ID><NAME>node0</NAME><STATE>3</STATE><LCM_STATE>3</LCM_STATE><TEMPLATE><OS><UUID>uuid-10</UUID></OS></TEMPLATE></VM>
+<VM><ID>11</ID><NAME>node1</NAME><STATE>8</STATE><LCM_STATE>0</LCM_STATE><TEMPLATE><OS><UUID>uuid-11</UUID></OS></TEMPLATE></VM>
+</VM_POOL>`
+
+func TestInventory(t *testing.T) {
+	one := newFakeONe(map[string]string{"one.vmpool.infoextended": inventoryPool})
+	defer one.Close()
+
+	interval := time.Hour
+	inv := NewInventory(one.controller(), ONEInventory{RefreshInterval: &interval})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vms, ok, err := inv.ByUUID(context.TODO(), "uuid-11")
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Len(t, vms, 1)
+			assert.Equal(t, 11, vms[0].ID)
+		}()
+	}
+	wg.Wait()
+
+	vm, ok, err := inv.ByID(context.TODO(), 10)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "node0", vm.Name)
+
+	_, ok, err = inv.ByID(context.TODO(), 12)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	hits, misses := inv.Stats()
+	assert.Equal(t, uint64(9), hits)
+	assert.Equal(t, uint64(1), misses)
+	assert.Equal(t, 1, one.callCount("one.vmpool.infoextended"))
+}
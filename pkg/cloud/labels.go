@@ -0,0 +1,119 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"strings"
+
+	dyn "github.com/OpenNebula/one/src/oca/go/src/goca/dynamic"
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultNodeLabelsPrefix = "K8S_LABEL_"
+
+	userTemplateLabelsKey = "LABELS"
+)
+
+// additionalLabels merges all node labels derived from the VM.
+func (i2 *InstancesV2) additionalLabels(ctx context.Context, vm *goca_vm.VM) (map[string]string, error) {
+	labels := map[string]string{}
+	for k, v := range i2.userTemplateLabels(vm) {
+		labels[k] = v
+	}
+	if !i2.hostLabelsCfg.Disabled {
+		hostLabels, err := i2.hostLabels(ctx, vm)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range hostLabels {
+			labels[k] = v
+		}
+	}
+	for k, v := range pciLabels(vm) {
+		labels[k] = v
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
+
+func resolveNodeLabels(cfg OpenNebulaConfig) *ONENodeLabels {
+	if cfg.NodeLabels == nil {
+		return nil
+	}
+	resolved := *cfg.NodeLabels
+	if len(resolved.Prefix) == 0 && len(resolved.Attributes) == 0 {
+		resolved.Prefix = defaultNodeLabelsPrefix
+	}
+	return &resolved
+}
+
+// labelKey returns the node label key for a USER_TEMPLATE attribute, or false if the attribute is not selected.
+// NOTE: OpenNebula upper-cases attribute names, so label keys are lower-cased.
+func (cfg *ONENodeLabels) labelKey(attribute string) (string, bool) {
+	if len(cfg.Prefix) > 0 && strings.HasPrefix(attribute, strings.ToUpper(cfg.Prefix)) {
+		return strings.ToLower(attribute[len(cfg.Prefix):]), true
+	}
+	for _, allowed := range cfg.Attributes {
+		if strings.EqualFold(attribute, allowed) {
+			return strings.ToLower(attribute), true
+		}
+	}
+	return "", false
+}
+
+// userTemplateLabels copies selected top-level USER_TEMPLATE attributes and the ones nested inside the LABELS vector.
+func (i2 *InstancesV2) userTemplateLabels(vm *goca_vm.VM) map[string]string {
+	if i2.nodeLabels == nil {
+		return nil
+	}
+	labels := map[string]string{}
+	addPair := func(pair *dyn.Pair) {
+		key, ok := i2.nodeLabels.labelKey(pair.Key())
+		if !ok {
+			return
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			klog.Warningf("VM %d: skipping invalid label key %q: %s", vm.ID, key, strings.Join(errs, ", "))
+			return
+		}
+		if errs := validation.IsValidLabelValue(pair.Value); len(errs) > 0 {
+			klog.Warningf("VM %d: skipping invalid label value %q: %s", vm.ID, pair.Value, strings.Join(errs, ", "))
+			return
+		}
+		labels[key] = pair.Value
+	}
+	for _, e := range vm.UserTemplate.Elements {
+		switch e := e.(type) {
+		case *dyn.Pair:
+			addPair(e)
+		case *dyn.Vector:
+			if e.Key() != userTemplateLabelsKey {
+				continue
+			}
+			for idx := range e.Pairs {
+				addPair(&e.Pairs[idx])
+			}
+		}
+	}
+	return labels
+}
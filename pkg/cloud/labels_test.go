@@ -0,0 +1,56 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const labeledVM = `<VM><ID>50</ID><NAME>node0</NAME>
+<USER_TEMPLATE>
+<K8S_LABEL_STORAGE>ssd</K8S_LABEL_STORAGE>
+<K8S_LABEL_ZONE.EXAMPLE.COM>a</K8S_LABEL_ZONE.EXAMPLE.COM>
+<K8S_LABEL_TEAM>not valid!</K8S_LABEL_TEAM>
+<TEAM>infra</TEAM>
+<LOGO>images/logos/ubuntu.png</LOGO>
+<LABELS><K8S_LABEL_TIER>gold</K8S_LABEL_TIER><COST_CENTER>42</COST_CENTER></LABELS>
+</USER_TEMPLATE>
+</VM>`
+
+func TestUserTemplateLabels(t *testing.T) {
+	vm := mustParseVM(t, labeledVM)
+
+	i2 := &InstancesV2{}
+	assert.Nil(t, i2.userTemplateLabels(vm))
+
+	i2 = &InstancesV2{nodeLabels: resolveNodeLabels(OpenNebulaConfig{NodeLabels: &ONENodeLabels{}})}
+	assert.Equal(t, map[string]string{
+		"storage":          "ssd",
+		"zone.example.com": "a",
+		"tier":             "gold",
+	}, i2.userTemplateLabels(vm))
+
+	i2 = &InstancesV2{nodeLabels: resolveNodeLabels(OpenNebulaConfig{NodeLabels: &ONENodeLabels{
+		Attributes: []string{"team", "COST_CENTER"},
+	}})}
+	assert.Equal(t, map[string]string{
+		"team":        "infra",
+		"cost_center": "42",
+	}, i2.userTemplateLabels(vm))
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"fmt"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+var (
+	// VMs in these states do not exist anymore from the Kubernetes point of view (node gets deleted).
+	defaultGoneStates = []string{
+		goca_vm.Done.String(),
+	}
+	// VMs in these states are not running, but may come back (node gets tainted).
+	defaultShutdownStates = []string{
+		goca_vm.Stopped.String(),
+		goca_vm.Suspended.String(),
+		goca_vm.Poweroff.String(),
+		goca_vm.Undeployed.String(),
+		goca_vm.CloningFailure.String(),
+		// ACTIVE
+		goca_vm.SaveStop.String(),
+		goca_vm.SaveSuspend.String(),
+		goca_vm.SaveMigrate.String(),
+		goca_vm.PrologMigrate.String(),
+		goca_vm.PrologResume.String(),
+		goca_vm.EpilogStop.String(),
+		goca_vm.Epilog.String(),
+		goca_vm.Shutdown.String(),
+		goca_vm.CleanupResubmit.String(),
+		goca_vm.Unknown.String(),
+		goca_vm.ShutdownPoweroff.String(),
+		goca_vm.BootUnknown.String(),
+		goca_vm.BootPoweroff.String(),
+		goca_vm.BootSuspended.String(),
+		goca_vm.BootStopped.String(),
+		goca_vm.CleanupDelete.String(),
+		goca_vm.ShutdownUndeploy.String(),
+		goca_vm.EpilogUndeploy.String(),
+		goca_vm.PrologUndeploy.String(),
+		goca_vm.BootUndeploy.String(),
+		goca_vm.BootMigrate.String(),
+		goca_vm.BootFailure.String(),
+		goca_vm.BootMigrateFailure.String(),
+		goca_vm.PrologMigrateFailure.String(),
+		goca_vm.PrologFailure.String(),
+		goca_vm.EpilogFailure.String(),
+		goca_vm.EpilogStopFailure.String(),
+		goca_vm.EpilogUndeployFailure.String(),
+		goca_vm.PrologMigratePoweroff.String(),
+		goca_vm.PrologMigratePoweroffFailure.String(),
+		goca_vm.PrologMigrateSuspend.String(),
+		goca_vm.PrologMigrateSuspendFailure.String(),
+		goca_vm.BootUndeployFailure.String(),
+		goca_vm.BootStoppedFailure.String(),
+		goca_vm.PrologResumeFailure.String(),
+		goca_vm.PrologUndeployFailure.String(),
+		goca_vm.PrologMigrateUnknown.String(),
+		goca_vm.PrologMigrateUnknownFailure.String(),
+	}
+)
+
+// vmStateSet matches VMs by state name (e.g. POWEROFF) or, for ACTIVE VMs, by LCM state name (e.g. BOOT_FAILURE).
+type vmStateSet map[string]struct{}
+
+func newVMStateSet(names []string) (vmStateSet, error) {
+	set := vmStateSet{}
+	for _, name := range names {
+		_, isState := vmStatesByName[name]
+		_, isLCMState := vmLCMStatesByName[name]
+		if !isState && !isLCMState {
+			return nil, fmt.Errorf("unexpected VM state: %s", name)
+		}
+		set[name] = struct{}{}
+	}
+	return set, nil
+}
+
+func (set vmStateSet) contains(vm *goca_vm.VM) bool {
+	state := goca_vm.State(vm.StateRaw)
+	if _, ok := set[state.String()]; ok {
+		return true
+	}
+	if state != goca_vm.Active {
+		return false
+	}
+	_, ok := set[goca_vm.LCMState(vm.LCMStateRaw).String()]
+	return ok
+}
+
+type instanceLifecycle struct {
+	gone     vmStateSet
+	shutdown vmStateSet
+}
+
+func resolveInstanceLifecycle(cfg OpenNebulaConfig) (*instanceLifecycle, error) {
+	gone, shutdown := defaultGoneStates, defaultShutdownStates
+	if cfg.InstanceStates != nil {
+		if cfg.InstanceStates.Gone != nil {
+			gone = cfg.InstanceStates.Gone
+		}
+		if cfg.InstanceStates.Shutdown != nil {
+			shutdown = cfg.InstanceStates.Shutdown
+		}
+	}
+	goneSet, err := newVMStateSet(gone)
+	if err != nil {
+		return nil, err
+	}
+	shutdownSet, err := newVMStateSet(shutdown)
+	if err != nil {
+		return nil, err
+	}
+	return &instanceLifecycle{
+		gone:     goneSet,
+		shutdown: shutdownSet,
+	}, nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"testing"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceLifecycle(t *testing.T) {
+	lifecycle, err := resolveInstanceLifecycle(OpenNebulaConfig{})
+	assert.Nil(t, err)
+
+	for _, tc := range []struct {
+		state    goca_vm.State
+		lcmState goca_vm.LCMState
+		shutdown bool
+		gone     bool
+	}{
+		{goca_vm.Active, goca_vm.Running, false, false},
+		{goca_vm.Active, goca_vm.Migrate, false, false},
+		{goca_vm.Active, goca_vm.Unknown, true, false},
+		{goca_vm.Active, goca_vm.BootFailure, true, false},
+		{goca_vm.Active, goca_vm.PrologMigrate, true, false},
+		{goca_vm.Stopped, goca_vm.LcmInit, true, false},
+		{goca_vm.Suspended, goca_vm.LcmInit, true, false},
+		{goca_vm.Poweroff, goca_vm.LcmInit, true, false},
+		{goca_vm.Done, goca_vm.LcmInit, false, true},
+	} {
+		vm := &goca_vm.VM{StateRaw: int(tc.state), LCMStateRaw: int(tc.lcmState)}
+		name := tc.state.String() + "/" + tc.lcmState.String()
+		assert.Equal(t, tc.shutdown, lifecycle.shutdown.contains(vm), name)
+		assert.Equal(t, tc.gone, lifecycle.gone.contains(vm), name)
+	}
+
+	lifecycle, err = resolveInstanceLifecycle(OpenNebulaConfig{InstanceStates: &ONEInstanceStates{
+		Gone:     []string{"DONE", "CLONINGFAILURE"},
+		Shutdown: []string{"POWEROFF"},
+	}})
+	assert.Nil(t, err)
+	assert.True(t, lifecycle.gone.contains(&goca_vm.VM{StateRaw: int(goca_vm.CloningFailure)}))
+	assert.False(t, lifecycle.shutdown.contains(&goca_vm.VM{StateRaw: int(goca_vm.Stopped)}))
+
+	_, err = resolveInstanceLifecycle(OpenNebulaConfig{InstanceStates: &ONEInstanceStates{Gone: []string{"asd"}}})
+	assert.NotNil(t, err)
+}
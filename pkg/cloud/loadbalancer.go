@@ -20,10 +20,18 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
 	"k8s.io/klog/v2"
 
 	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
@@ -32,12 +40,28 @@ import (
 	goca_vr "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/virtualrouter"
 )
 
+const (
+	haproxyLBPrefix = "ONEAPP_VNF_HAPROXY_LB"
+	lvsLBPrefix     = "ONEAPP_VNF_LB"
+
+	loadBalancerIPAnnotation = "opennebula.io/load-balancer-ip"
+)
+
+var lbContextKeyRe = regexp.MustCompile(`^(ONEAPP_VNF_HAPROXY_LB|ONEAPP_VNF_LB)(\d+)_(.+)$`)
+
 type LoadBalancer struct {
 	Disabled       bool
 	ctrl           *goca.Controller
 	publicNetwork  *ONEVirtualNetwork
 	privateNetwork *ONEVirtualNetwork
 	virtualRouter  *ONEVirtualRouter
+	class          string
+	client         clientset.Interface // set in Initialize, used to find endpoints of Local services
+	localBackends  bool                // set when LocalTrafficController keeps backends of Local services up to date
+
+	// mu serializes changes of the shared VNET reservations and VR context, the service controller
+	// and the LoadBalancerClass controller call the mutating methods concurrently.
+	mu sync.Mutex
 }
 
 func NewLoadBalancer(cfg OpenNebulaConfig) (*LoadBalancer, error) {
@@ -50,6 +74,10 @@ func NewLoadBalancer(cfg OpenNebulaConfig) (*LoadBalancer, error) {
 		klog.Errorf("no VirtualRouter template defined, disabling LoadBalancer")
 		disabled = true
 	}
+	class := ""
+	if cfg.VirtualRouter != nil {
+		class = strings.TrimSpace(cfg.VirtualRouter.LoadBalancerClass)
+	}
 	ctrl := goca.NewController(goca.NewDefaultClient(goca.OneConfig{
 		Endpoint: cfg.Endpoint.ONE_XMLRPC,
 		Token:    cfg.Endpoint.ONE_AUTH,
@@ -60,9 +88,19 @@ func NewLoadBalancer(cfg OpenNebulaConfig) (*LoadBalancer, error) {
 		publicNetwork:  cfg.PublicNetwork,
 		privateNetwork: cfg.PrivateNetwork,
 		virtualRouter:  cfg.VirtualRouter,
+		class:          class,
 	}, nil
 }
 
+// claims tells if the service is handled by this provider, that is services of the default class
+// and of the configured one, services of other classes belong to other implementations.
+func (lb *LoadBalancer) claims(service *corev1.Service) bool {
+	if service.Spec.LoadBalancerClass == nil {
+		return true
+	}
+	return len(lb.class) > 0 && *service.Spec.LoadBalancerClass == lb.class
+}
+
 func (lb *LoadBalancer) getLBReservationName(clusterName string) string {
 	return fmt.Sprintf("%s-lb", clusterName)
 }
@@ -101,7 +139,7 @@ func (lb *LoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string,
 	if lb.Disabled {
 		return nil, false, fmt.Errorf("LoadBalancer disabled")
 	}
-	if service.Spec.LoadBalancerClass != nil {
+	if !lb.claims(service) {
 		return nil, false, nil
 	}
 
@@ -169,11 +207,30 @@ func (lb *LoadBalancer) ensureVRReservationCreated(ctx context.Context, clusterN
 	return lb.ctrl.VirtualNetwork(vnID).InfoContext(ctx, true)
 }
 
-func (lb *LoadBalancer) ensureLBReservationCreated(ctx context.Context, clusterName, lbName string) (*goca_vn.VirtualNetwork, int, error) {
+// requestedLoadBalancerIP returns the IP requested by the annotation or (deprecated) spec.loadBalancerIP, if any.
+func (lb *LoadBalancer) requestedLoadBalancerIP(service *corev1.Service) (string, error) {
+	ip, ok := service.Annotations[loadBalancerIPAnnotation]
+	if !ok {
+		ip = service.Spec.LoadBalancerIP
+	}
+	ip = strings.TrimSpace(ip)
+	if len(ip) == 0 {
+		return "", nil
+	}
+	if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+		return "", fmt.Errorf("invalid load balancer IP %q", ip)
+	}
+	return ip, nil
+}
+
+func (lb *LoadBalancer) ensureLBReservationCreated(ctx context.Context, clusterName, lbName, requestedIP string) (*goca_vn.VirtualNetwork, int, error) {
 	vn, arIdx, err := lb.findLoadBalancer(ctx, clusterName, lbName)
 	if err != nil {
 		return nil, -1, err
 	}
+	if arIdx >= 0 && len(requestedIP) > 0 && vn.ARs[arIdx].IP != requestedIP {
+		return nil, -1, fmt.Errorf("load balancer %s already has IP %s, recreate the service to get %s", lbName, vn.ARs[arIdx].IP, requestedIP)
+	}
 	if arIdx < 0 { // not found
 		parentNetwork := lb.getPrimaryNetwork()
 		parentID, err := lb.ctrl.VirtualNetworks().ByNameContext(ctx, parentNetwork.Name)
@@ -184,6 +241,20 @@ func (lb *LoadBalancer) ensureLBReservationCreated(ctx context.Context, clusterN
 		template := &goca_dyn.Template{}
 		template.AddPair("NAME", lb.getLBReservationName(clusterName))
 		template.AddPair("SIZE", 1)
+		if len(requestedIP) > 0 {
+			parent, err := lb.ctrl.VirtualNetwork(parentID).InfoContext(ctx, true)
+			if err != nil {
+				return nil, -1, err
+			}
+			for _, ar := range parent.ARs {
+				for _, lease := range ar.Leases {
+					if lease.IP == requestedIP {
+						return nil, -1, fmt.Errorf("load balancer IP %s is already leased in network %s", requestedIP, parentNetwork.Name)
+					}
+				}
+			}
+			template.AddPair("IP", requestedIP)
+		}
 		if parentNetwork.AddressRangeID != nil && *parentNetwork.AddressRangeID >= 0 {
 			template.AddPair("AR_ID", *parentNetwork.AddressRangeID)
 		} else {
@@ -311,16 +382,74 @@ func (lb *LoadBalancer) ensureVirtualRouterCreated(ctx context.Context, clusterN
 	return lb.ctrl.VirtualRouter(vrID).InfoContext(ctx, true)
 }
 
-func (lb *LoadBalancer) reindexLoadBalancers(vn *goca_vn.VirtualNetwork, contextVec *goca_dyn.Vector, update []map[string]string) {
-	byLB := map[string]map[string]string{}
+// lbContextPrefix returns the VNF context prefix of the LB module serving the protocol,
+// HAProxy for TCP and LVS (keepalived) for UDP, which HAProxy can not proxy.
+func (lb *LoadBalancer) lbContextPrefix(protocol corev1.Protocol) (string, error) {
+	switch protocol {
+	case "", corev1.ProtocolTCP:
+		return haproxyLBPrefix, nil
+	case corev1.ProtocolUDP:
+		if !lb.isNodesGateway() {
+			return "", fmt.Errorf("protocol UDP needs the VR to be the gateway of the nodes, set privateNetwork.floatingIP and route the nodes through it")
+		}
+		return lvsLBPrefix, nil
+	default:
+		// NOTE: The LVS module of the VNF accepts only TCP and UDP.
+		return "", fmt.Errorf("protocol %s not supported by LoadBalancer, use TCP or UDP", protocol)
+	}
+}
+
+// isNodesGateway tells if the VR is configured as the gateway of the nodes, which LVS-NAT requires,
+// since replies of the backends must go back through the VR, nodes are expected to route through
+// the floating IP of the private network.
+func (lb *LoadBalancer) isNodesGateway() bool {
+	return lb.privateNetwork != nil && lb.privateNetwork.FloatingIP != nil && net.ParseIP(*lb.privateNetwork.FloatingIP) != nil
+}
+
+func (lb *LoadBalancer) validateService(service *corev1.Service) error {
+	for _, port := range service.Spec.Ports {
+		if _, err := lb.lbContextPrefix(port.Protocol); err != nil {
+			return fmt.Errorf("port %s/%d: %w", port.Name, port.Port, err)
+		}
+	}
+	return nil
+}
+
+// checkSourceRanges refuses to create LBs restricted to loadBalancerSourceRanges, which can not be enforced.
+// Neither module of the VNF filters clients and security groups apply to the whole NIC of the VR (all VIPs),
+// next to the permissive groups of the network. Existing LBs are only warned about, so they keep being synced.
+func (lb *LoadBalancer) checkSourceRanges(service *corev1.Service, exists bool) error {
+	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(service)
+	if err == nil && servicehelpers.IsAllowAll(sourceRanges) {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("loadBalancerSourceRanges %v not supported by LoadBalancer, the virtual router can not restrict clients", sourceRanges.StringSlice())
+	}
+	if exists {
+		klog.Warningf("service %s/%s: %v, LB stays open to all clients", service.Namespace, service.Name, err)
+		return nil
+	}
+	return err
+}
+
+// reindexLoadBalancers replaces the LB entries of the given IP with update (keyed by context prefix),
+// keeps entries of the other IPs still reserved and renumbers everything.
+func (lb *LoadBalancer) reindexLoadBalancers(vn *goca_vn.VirtualNetwork, contextVec *goca_dyn.Vector, ip string, update map[string][]map[string]string) {
+	byLB := map[string]map[int]map[string]string{}
 	for _, p := range contextVec.Pairs {
-		if strings.HasPrefix(p.Key(), "ONEAPP_VNF_HAPROXY_LB") {
-			t := strings.Split(p.Key(), "_")
-			if _, ok := byLB[t[3]]; !ok {
-				byLB[t[3]] = map[string]string{}
-			}
-			byLB[t[3]][strings.Join(t[4:], "_")] = p.Value
+		m := lbContextKeyRe.FindStringSubmatch(p.Key())
+		if m == nil {
+			continue
+		}
+		idx, _ := strconv.Atoi(m[2])
+		if _, ok := byLB[m[1]]; !ok {
+			byLB[m[1]] = map[int]map[string]string{}
+		}
+		if _, ok := byLB[m[1]][idx]; !ok {
+			byLB[m[1]][idx] = map[string]string{}
 		}
+		byLB[m[1]][idx][m[3]] = p.Value
 	}
 
 	filter := map[string]struct{}{}
@@ -328,22 +457,23 @@ func (lb *LoadBalancer) reindexLoadBalancers(vn *goca_vn.VirtualNetwork, context
 		filter[ar.IP] = struct{}{}
 	}
 
-	if len(update) > 0 {
-		for _, v := range byLB {
-			if v["IP"] == update[0]["IP"] {
+	entries := map[string][]map[string]string{}
+	for _, prefix := range []string{haproxyLBPrefix, lvsLBPrefix} {
+		entries[prefix] = append(entries[prefix], update[prefix]...)
+		indices := make([]int, 0, len(byLB[prefix]))
+		for idx := range byLB[prefix] {
+			indices = append(indices, idx)
+		}
+		sort.Ints(indices)
+		for _, idx := range indices {
+			v := byLB[prefix][idx]
+			if v["IP"] == ip {
 				continue
 			}
 			if _, ok := filter[v["IP"]]; !ok {
 				continue
 			}
-			update = append(update, v)
-		}
-	} else {
-		for _, v := range byLB {
-			if _, ok := filter[v["IP"]]; !ok {
-				continue
-			}
-			update = append(update, v)
+			entries[prefix] = append(entries[prefix], v)
 		}
 	}
 
@@ -351,7 +481,7 @@ func (lb *LoadBalancer) reindexLoadBalancers(vn *goca_vn.VirtualNetwork, context
 	for i, s := 0, len(contextVec.Pairs); i < s; {
 		k := contextVec.Pairs[i].Key()
 		switch {
-		case strings.HasPrefix(k, "ONEAPP_VROUTER_ETH0_VIP"), strings.HasPrefix(k, "ONEAPP_VNF_HAPROXY_LB"):
+		case strings.HasPrefix(k, "ONEAPP_VROUTER_ETH0_VIP"), lbContextKeyRe.MatchString(k):
 			contextVec.Pairs = append(contextVec.Pairs[:i], contextVec.Pairs[i+1:]...)
 			s--
 		default:
@@ -363,14 +493,123 @@ func (lb *LoadBalancer) reindexLoadBalancers(vn *goca_vn.VirtualNetwork, context
 	for i, ar := range vn.ARs {
 		contextVec.AddPair(fmt.Sprintf("ONEAPP_VROUTER_ETH0_VIP%d", i), ar.IP)
 	}
-	for i, v := range update {
-		for x, y := range v {
-			contextVec.AddPair(fmt.Sprintf("ONEAPP_VNF_HAPROXY_LB%d_%s", i, x), y)
+	for _, prefix := range []string{haproxyLBPrefix, lvsLBPrefix} {
+		for i, v := range entries[prefix] {
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				contextVec.AddPair(fmt.Sprintf("%s%d_%s", prefix, i, k), v[k])
+			}
 		}
 	}
+	// NOTE: VRs created before UDP support have only HAProxy enabled.
+	if len(entries[lvsLBPrefix]) > 0 {
+		contextVec.Del("ONEAPP_VNF_LB_ENABLED")
+		contextVec.AddPair("ONEAPP_VNF_LB_ENABLED", "YES")
+	}
 }
 
-func (lb *LoadBalancer) updateVirtualRouterInstances(ctx context.Context, vr *goca_vr.VirtualRouter, vn *goca_vn.VirtualNetwork, arIdx int, service *corev1.Service, nodes []*corev1.Node) error {
+// serviceLoadBalancers returns the VNF LB entries (keyed by context prefix) of the service ports.
+func (lb *LoadBalancer) serviceLoadBalancers(ip string, service *corev1.Service, nodes []*corev1.Node) (map[string][]map[string]string, error) {
+	update := map[string][]map[string]string{}
+	for _, port := range service.Spec.Ports {
+		prefix, err := lb.lbContextPrefix(port.Protocol)
+		if err != nil {
+			return nil, err
+		}
+		// NOTE: HAProxy replaces the client address with its own, LVS-NAT preserves it as the Local policy
+		// requires, but only works when the VR is the gateway of the nodes.
+		if servicehelpers.RequestsOnlyLocalTraffic(service) && lb.isNodesGateway() {
+			prefix = lvsLBPrefix
+		}
+		v := map[string]string{
+			"IP":   ip,
+			"PORT": fmt.Sprint(port.Port),
+		}
+		if prefix == lvsLBPrefix {
+			v["PROTOCOL"] = string(corev1.ProtocolTCP)
+			if len(port.Protocol) > 0 {
+				v["PROTOCOL"] = string(port.Protocol)
+			}
+			v["METHOD"] = "NAT"
+		}
+		for i, node := range nodes {
+			var nodeIP string
+			for _, addr := range node.Status.Addresses {
+				if addr.Type == corev1.NodeInternalIP {
+					nodeIP = addr.Address
+					break
+				}
+			}
+			if net.ParseIP(nodeIP) != nil {
+				v[fmt.Sprintf("SERVER%d_HOST", i)] = nodeIP
+				v[fmt.Sprintf("SERVER%d_PORT", i)] = fmt.Sprint(port.NodePort)
+			}
+		}
+		update[prefix] = append(update[prefix], v)
+	}
+	return update, nil
+}
+
+// followEndpoints makes Local services use only nodes with ready endpoints as backends from now on.
+func (lb *LoadBalancer) followEndpoints() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.localBackends = true
+}
+
+// trafficBackends returns the nodes traffic of the service is sent to, with the Local policy only nodes
+// running ready endpoints (kube-proxy drops traffic on the others). Backends are narrowed only while
+// LocalTrafficController runs, nothing else would follow the endpoints moving to other nodes.
+func (lb *LoadBalancer) trafficBackends(ctx context.Context, service *corev1.Service, nodes []*corev1.Node) ([]*corev1.Node, error) {
+	if !servicehelpers.RequestsOnlyLocalTraffic(service) || !lb.localBackends {
+		return nodes, nil
+	}
+	if lb.client == nil {
+		return nil, fmt.Errorf("LoadBalancer not initialized")
+	}
+	endpointSlices, err := lb.client.DiscoveryV1().EndpointSlices(service.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{discoveryv1.LabelServiceName: service.Name}.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filterLocalBackends(endpointSlices.Items, nodes), nil
+}
+
+func filterLocalBackends(endpointSlices []discoveryv1.EndpointSlice, nodes []*corev1.Node) []*corev1.Node {
+	ready := map[string]struct{}{}
+	for _, slice := range endpointSlices {
+		for _, ep := range slice.Endpoints {
+			if ep.NodeName != nil && (ep.Conditions.Ready == nil || *ep.Conditions.Ready) {
+				ready[*ep.NodeName] = struct{}{}
+			}
+		}
+	}
+	backends := []*corev1.Node{}
+	for _, node := range nodes {
+		if _, ok := ready[node.Name]; ok {
+			backends = append(backends, node)
+		}
+	}
+	return backends
+}
+
+func (lb *LoadBalancer) updateVirtualRouterInstances(ctx context.Context, vr *goca_vr.VirtualRouter, vn *goca_vn.VirtualNetwork, ip string, service *corev1.Service, nodes []*corev1.Node) error {
+	update := map[string][]map[string]string{}
+	if nodes != nil {
+		backends, err := lb.trafficBackends(ctx, service, nodes)
+		if err != nil {
+			return err
+		}
+		if update, err = lb.serviceLoadBalancers(ip, service, backends); err != nil {
+			return err
+		}
+	}
+
 	for _, vmID := range vr.VMs.ID {
 		vm, err := lb.ctrl.VM(vmID).InfoContext(ctx, true)
 		if err != nil {
@@ -381,30 +620,7 @@ func (lb *LoadBalancer) updateVirtualRouterInstances(ctx context.Context, vr *go
 			return err
 		}
 
-		update := []map[string]string{}
-		if nodes != nil {
-			for _, port := range service.Spec.Ports {
-				v := map[string]string{
-					"IP":   vn.ARs[arIdx].IP,
-					"PORT": fmt.Sprint(port.Port),
-				}
-				for i, node := range nodes {
-					var nodeIP string
-					for _, addr := range node.Status.Addresses {
-						if addr.Type == corev1.NodeInternalIP {
-							nodeIP = addr.Address
-							break
-						}
-					}
-					if net.ParseIP(nodeIP) != nil {
-						v[fmt.Sprintf("SERVER%d_HOST", i)] = nodeIP
-						v[fmt.Sprintf("SERVER%d_PORT", i)] = fmt.Sprint(port.NodePort)
-					}
-				}
-				update = append(update, v)
-			}
-		}
-		lb.reindexLoadBalancers(vn, contextVec, update)
+		lb.reindexLoadBalancers(vn, contextVec, ip, update)
 
 		if err := lb.ctrl.VM(vmID).UpdateConfContext(ctx, vm.Template.String()); err != nil {
 			return err
@@ -417,18 +633,36 @@ func (lb *LoadBalancer) updateVirtualRouterInstances(ctx context.Context, vr *go
 func (lb *LoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) (*corev1.LoadBalancerStatus, error) {
 	klog.Infof("EnsureLoadBalancer(): %s", clusterName)
 
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
 	if lb.Disabled {
 		return nil, fmt.Errorf("LoadBalancer disabled")
 	}
-	if service.Spec.LoadBalancerClass != nil {
-		return nil, fmt.Errorf("LoadBalancer class unexpected")
+	if !lb.claims(service) {
+		klog.Infof("skipping service %s/%s of LoadBalancer class %s", service.Namespace, service.Name, *service.Spec.LoadBalancerClass)
+		return &service.Status.LoadBalancer, nil
+	}
+	if err := lb.validateService(service); err != nil {
+		return nil, err
+	}
+	requestedIP, err := lb.requestedLoadBalancerIP(service)
+	if err != nil {
+		return nil, err
+	}
+	_, arIdx, err := lb.findLoadBalancer(ctx, clusterName, lb.GetLoadBalancerName(ctx, clusterName, service))
+	if err != nil {
+		return nil, err
+	}
+	if err := lb.checkSourceRanges(service, arIdx >= 0); err != nil {
+		return nil, err
 	}
 
-	_, err := lb.ensureVRReservationCreated(ctx, clusterName)
+	_, err = lb.ensureVRReservationCreated(ctx, clusterName)
 	if err != nil {
 		return nil, err
 	}
-	vn, arIdx, err := lb.ensureLBReservationCreated(ctx, clusterName, lb.GetLoadBalancerName(ctx, clusterName, service))
+	vn, arIdx, err := lb.ensureLBReservationCreated(ctx, clusterName, lb.GetLoadBalancerName(ctx, clusterName, service), requestedIP)
 	if err != nil {
 		return nil, err
 	}
@@ -437,7 +671,7 @@ func (lb *LoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName stri
 	if err != nil {
 		return nil, err
 	}
-	if err := lb.updateVirtualRouterInstances(ctx, vr, vn, arIdx, service, nodes); err != nil {
+	if err := lb.updateVirtualRouterInstances(ctx, vr, vn, vn.ARs[arIdx].IP, service, nodes); err != nil {
 		return nil, err
 	}
 
@@ -451,11 +685,18 @@ func (lb *LoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName stri
 func (lb *LoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *corev1.Service, nodes []*corev1.Node) error {
 	klog.Infof("UpdateLoadBalancer(): %s", clusterName)
 
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
 	if lb.Disabled {
 		return fmt.Errorf("LoadBalancer disabled")
 	}
-	if service.Spec.LoadBalancerClass != nil {
-		return fmt.Errorf("LoadBalancer class unexpected")
+	if !lb.claims(service) {
+		klog.Infof("skipping service %s/%s of LoadBalancer class %s", service.Namespace, service.Name, *service.Spec.LoadBalancerClass)
+		return nil
+	}
+	if err := lb.validateService(service); err != nil {
+		return err
 	}
 
 	vrID, err := lb.ctrl.VirtualRouterByNameContext(ctx, lb.getVirtualRouterName(clusterName))
@@ -474,8 +715,11 @@ func (lb *LoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName stri
 	if arIdx < 0 {
 		return nil
 	}
+	if err := lb.checkSourceRanges(service, true); err != nil {
+		return err
+	}
 
-	if err := lb.updateVirtualRouterInstances(ctx, vr, vn, arIdx, service, nodes); err != nil {
+	if err := lb.updateVirtualRouterInstances(ctx, vr, vn, vn.ARs[arIdx].IP, service, nodes); err != nil {
 		return err
 	}
 
@@ -485,11 +729,15 @@ func (lb *LoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName stri
 func (lb *LoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *corev1.Service) error {
 	klog.Infof("EnsureLoadBalancerDeleted(): %s", clusterName)
 
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
 	if lb.Disabled {
 		return fmt.Errorf("LoadBalancer disabled")
 	}
-	if service.Spec.LoadBalancerClass != nil {
-		return fmt.Errorf("LoadBalancer class unexpected")
+	if !lb.claims(service) {
+		klog.Infof("skipping service %s/%s of LoadBalancer class %s", service.Namespace, service.Name, *service.Spec.LoadBalancerClass)
+		return nil
 	}
 
 	vn, arIdx, err := lb.findLoadBalancer(ctx, clusterName, lb.GetLoadBalancerName(ctx, clusterName, service))
@@ -506,8 +754,9 @@ func (lb *LoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterNa
 		if err != nil {
 			return err
 		}
+		ip := vn.ARs[arIdx].IP
 		release := goca_dyn.NewVector("LEASES")
-		release.AddPair("IP", vn.ARs[arIdx].IP)
+		release.AddPair("IP", ip)
 		if err := lb.ctrl.VirtualNetwork(vn.ID).ReleaseContext(ctx, release.String()); err != nil {
 			return err
 		}
@@ -527,7 +776,7 @@ func (lb *LoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterNa
 		if err != nil {
 			return err
 		}
-		if err := lb.updateVirtualRouterInstances(ctx, vr, vn, arIdx, service, nil); err != nil {
+		if err := lb.updateVirtualRouterInstances(ctx, vr, vn, ip, service, nil); err != nil {
 			return err
 		}
 	case 1: // Since this is the last item in the reservation then VR itself can be removed.
@@ -19,13 +19,20 @@ package opennebula
 import (
 	"context"
 	"fmt"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 
 	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
+	goca_dyn "github.com/OpenNebula/one/src/oca/go/src/goca/dynamic"
+	goca_vn "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/virtualnetwork"
 )
 
 type lbStep struct {
@@ -296,6 +303,325 @@ var lbDeleteSecondService = []lbStep{
 	},
 }
 
+// Create a Service with TCP and UDP Ports.
+var lbMixedProtocols = []lbStep{
+	lbStep{
+		destroy: false,
+		services: []*corev1.Service{
+			&corev1.Service{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Service",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "Service0",
+				},
+				Spec: corev1.ServiceSpec{
+					Type: "LoadBalancer",
+					Ports: []corev1.ServicePort{
+						corev1.ServicePort{
+							Name:     "dns-tcp",
+							Protocol: "TCP",
+							Port:     53,
+							NodePort: 30053,
+						},
+						corev1.ServicePort{
+							Name:     "dns-udp",
+							Protocol: "UDP",
+							Port:     53,
+							NodePort: 30054,
+						},
+					},
+				},
+				Status: corev1.ServiceStatus{},
+			},
+		},
+		nodes: lbSinglePort[0].nodes,
+		context: map[string]string{
+			"ONEAPP_VNF_HAPROXY_LB0_PORT":         "53",
+			"ONEAPP_VNF_HAPROXY_LB0_SERVER0_HOST": "172.20.0.102",
+			"ONEAPP_VNF_HAPROXY_LB0_SERVER0_PORT": "30053",
+			"ONEAPP_VNF_LB_ENABLED":               "YES",
+			"ONEAPP_VNF_LB0_PORT":                 "53",
+			"ONEAPP_VNF_LB0_PROTOCOL":             "UDP",
+			"ONEAPP_VNF_LB0_SERVER0_HOST":         "172.20.0.102",
+			"ONEAPP_VNF_LB0_SERVER0_PORT":         "30054",
+		},
+	},
+}
+
+func TestLBReindex(t *testing.T) {
+	vn := &goca_vn.VirtualNetwork{ARs: []goca_vn.AR{{IP: "10.2.11.200"}, {IP: "10.2.11.201"}}}
+	contextVec := goca_dyn.NewVector("CONTEXT")
+	contextVec.AddPair("TOKEN", "YES")
+	contextVec.AddPair("ONEAPP_VNF_HAPROXY_LB0_IP", "10.2.11.200")
+	contextVec.AddPair("ONEAPP_VNF_HAPROXY_LB0_PORT", "80")
+	contextVec.AddPair("ONEAPP_VNF_LB0_IP", "10.2.11.201")
+	contextVec.AddPair("ONEAPP_VNF_LB0_PORT", "53")
+	contextVec.AddPair("ONEAPP_VNF_LB0_PROTOCOL", "UDP")
+	contextVec.AddPair("ONEAPP_VNF_LB1_IP", "10.2.11.202") // released
+	contextVec.AddPair("ONEAPP_VNF_LB1_PORT", "123")
+
+	lb := &LoadBalancer{}
+	lb.reindexLoadBalancers(vn, contextVec, "10.2.11.201", map[string][]map[string]string{
+		haproxyLBPrefix: {{"IP": "10.2.11.201", "PORT": "53"}},
+		lvsLBPrefix:     {{"IP": "10.2.11.201", "PORT": "5353", "PROTOCOL": "UDP"}},
+	})
+
+	actual := map[string]string{}
+	for _, p := range contextVec.Pairs {
+		actual[p.Key()] = p.Value
+	}
+	assert.Equal(t, map[string]string{
+		"TOKEN":                       "YES",
+		"ONEAPP_VROUTER_ETH0_VIP0":    "10.2.11.200",
+		"ONEAPP_VROUTER_ETH0_VIP1":    "10.2.11.201",
+		"ONEAPP_VNF_HAPROXY_LB0_IP":   "10.2.11.201",
+		"ONEAPP_VNF_HAPROXY_LB0_PORT": "53",
+		"ONEAPP_VNF_HAPROXY_LB1_IP":   "10.2.11.200",
+		"ONEAPP_VNF_HAPROXY_LB1_PORT": "80",
+		"ONEAPP_VNF_LB0_IP":           "10.2.11.201",
+		"ONEAPP_VNF_LB0_PORT":         "5353",
+		"ONEAPP_VNF_LB0_PROTOCOL":     "UDP",
+		"ONEAPP_VNF_LB_ENABLED":       "YES",
+	}, actual)
+
+	// Removing the last UDP port drops the LVS entries.
+	lb.reindexLoadBalancers(vn, contextVec, "10.2.11.201", nil)
+	_, err := contextVec.GetStr("ONEAPP_VNF_LB0_IP")
+	assert.NotNil(t, err)
+	ip, err := contextVec.GetStr("ONEAPP_VNF_HAPROXY_LB0_IP")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.2.11.200", ip)
+}
+
+func TestLBServiceLoadBalancers(t *testing.T) {
+	lb := &LoadBalancer{}
+	service := &corev1.Service{Spec: corev1.ServiceSpec{
+		Type:                  corev1.ServiceTypeLoadBalancer,
+		Ports:                 []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}},
+		ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyCluster,
+		HealthCheckNodePort:   0,
+	}}
+
+	update, err := lb.serviceLoadBalancers("10.2.11.200", service, lbAddNode[1].nodes)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]map[string]string{haproxyLBPrefix: {{
+		"IP":           "10.2.11.200",
+		"PORT":         "80",
+		"SERVER0_HOST": "172.20.0.102",
+		"SERVER0_PORT": "30080",
+		"SERVER1_HOST": "172.20.0.103",
+		"SERVER1_PORT": "30080",
+	}}}, update)
+
+	// Local services stay on HAProxy unless the VR is the gateway of the nodes.
+	service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+	service.Spec.HealthCheckNodePort = 32000
+	update, err = lb.serviceLoadBalancers("10.2.11.200", service, lbAddNode[1].nodes[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]map[string]string{haproxyLBPrefix: {{
+		"IP":           "10.2.11.200",
+		"PORT":         "80",
+		"SERVER0_HOST": "172.20.0.102",
+		"SERVER0_PORT": "30080",
+	}}}, update)
+
+	// Then they go through LVS-NAT, which keeps client addresses.
+	lb.privateNetwork = &ONEVirtualNetwork{Name: "private", FloatingIP: &[]string{"172.20.0.1"}[0]}
+	update, err = lb.serviceLoadBalancers("10.2.11.200", service, lbAddNode[1].nodes[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]map[string]string{lvsLBPrefix: {{
+		"IP":           "10.2.11.200",
+		"PORT":         "80",
+		"PROTOCOL":     "TCP",
+		"METHOD":       "NAT",
+		"SERVER0_HOST": "172.20.0.102",
+		"SERVER0_PORT": "30080",
+	}}}, update)
+}
+
+func TestLBTrafficBackends(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "Service0"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyCluster},
+	}
+	nodes := lbAddNode[1].nodes
+
+	lb := &LoadBalancer{}
+	backends, err := lb.trafficBackends(context.TODO(), service, nodes)
+	assert.Nil(t, err)
+	assert.Equal(t, nodes, backends)
+
+	// Without LocalTrafficController nothing would follow the endpoints, all nodes stay backends.
+	service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+	backends, err = lb.trafficBackends(context.TODO(), service, nodes)
+	assert.Nil(t, err)
+	assert.Equal(t, nodes, backends)
+
+	lb.followEndpoints()
+	_, err = lb.trafficBackends(context.TODO(), service, nodes)
+	assert.NotNil(t, err)
+
+	lb.client = fake.NewSimpleClientset(newEndpointSlice("default", "Service0", map[string]bool{"Node0": false, "Node1": true}))
+	backends, err = lb.trafficBackends(context.TODO(), service, nodes)
+	assert.Nil(t, err)
+	assert.Equal(t, []*corev1.Node{nodes[1]}, backends)
+}
+
+func newEndpointSlice(namespace, serviceName string, readyByNode map[string]bool) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      serviceName + "-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: serviceName},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+	for nodeName, ready := range readyByNode {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{"10.244.0.10"},
+			Conditions: discoveryv1.EndpointConditions{Ready: &[]bool{ready}[0]},
+			NodeName:   &[]string{nodeName}[0],
+		})
+	}
+	return slice
+}
+
+// newLBFakeONe serves an existing LB of default/Service0 in cluster k8s, behind a VR with a single VM.
+func newLBFakeONe() *fakeONe {
+	lbVNet := `<VNET><ID>7</ID><NAME>k8s-lb</NAME><PARENT_NETWORK_ID>0</PARENT_NETWORK_ID><TEMPLATE></TEMPLATE><AR_POOL>
+<AR><AR_ID>1</AR_ID><IP>10.2.11.201</IP><SIZE>1</SIZE><TYPE>IP4</TYPE><LB_NAME>k8s-default-Service0</LB_NAME></AR>
+</AR_POOL></VNET>`
+	vr := `<VROUTER><ID>3</ID><NAME>k8s-lb</NAME><VMS><ID>50</ID></VMS><TEMPLATE></TEMPLATE></VROUTER>`
+	return newFakeONe(map[string]string{
+		"one.vnpool.info":      `<VNET_POOL>` + lbVNet + `</VNET_POOL>`,
+		"one.vn.info":          lbVNet,
+		"one.vrouterpool.info": `<VROUTER_POOL>` + vr + `</VROUTER_POOL>`,
+		"one.vrouter.info":     vr,
+		"one.vm.info":          `<VM><ID>50</ID><NAME>k8s-lb-0</NAME><TEMPLATE><CONTEXT><TOKEN>YES</TOKEN></CONTEXT></TEMPLATE></VM>`,
+		"one.vm.updateconf":    `50`,
+	})
+}
+
+const publicVNet = `<VNET><ID>0</ID><NAME>public</NAME><TEMPLATE></TEMPLATE><AR_POOL>
+<AR><AR_ID>0</AR_ID><IP>10.2.11.200</IP><SIZE>48</SIZE><TYPE>IP4</TYPE><LEASES>
+<LEASE><IP>10.2.11.200</IP><VNET>7</VNET></LEASE>
+</LEASES></AR>
+</AR_POOL></VNET>`
+
+func TestLBRequestedIP(t *testing.T) {
+	one := newFakeONe(map[string]string{
+		"one.vnpool.info":  `<VNET_POOL>` + publicVNet + `</VNET_POOL>`,
+		"one.vn.info":      publicVNet,
+		"one.vn.reserve":   `7`,
+		"one.vn.update_ar": `7`,
+		"one.vn.hold":      `7`,
+	})
+	defer one.Close()
+
+	lb := &LoadBalancer{ctrl: one.controller(), publicNetwork: &ONEVirtualNetwork{Name: "public"}}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "Service0"}}
+	ip, err := lb.requestedLoadBalancerIP(service)
+	assert.Nil(t, err)
+	assert.Empty(t, ip)
+
+	service.Spec.LoadBalancerIP = "10.2.11.200"
+	ip, err = lb.requestedLoadBalancerIP(service)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.2.11.200", ip)
+
+	service.Annotations = map[string]string{loadBalancerIPAnnotation: "10.2.11.201"}
+	ip, err = lb.requestedLoadBalancerIP(service)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.2.11.201", ip)
+
+	service.Annotations[loadBalancerIPAnnotation] = "public"
+	_, err = lb.requestedLoadBalancerIP(service)
+	assert.NotNil(t, err)
+
+	_, _, err = lb.ensureLBReservationCreated(context.TODO(), "k8s", "k8s-default-Service0", "10.2.11.200")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "already leased")
+	assert.Equal(t, 0, one.callCount("one.vn.reserve"))
+
+	_, _, err = lb.ensureLBReservationCreated(context.TODO(), "k8s", "k8s-default-Service0", "10.2.11.201")
+	assert.Nil(t, err)
+	params := one.stringParams("one.vn.reserve")
+	assert.Len(t, params, 2)
+	assert.Contains(t, params[1], `NAME="k8s-lb"`)
+	assert.Contains(t, params[1], `SIZE="1"`)
+	assert.Contains(t, params[1], `IP="10.2.11.201"`)
+}
+
+func TestLBValidateService(t *testing.T) {
+	lb := &LoadBalancer{privateNetwork: &ONEVirtualNetwork{Name: "private"}}
+	service := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+		{Name: "http", Port: 80},
+		{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53, NodePort: 30053},
+	}}}
+	// LVS-NAT needs replies of the nodes to go back through the VR.
+	err := lb.validateService(service)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "port dns/53: protocol UDP needs the VR to be the gateway of the nodes")
+
+	lb.privateNetwork.FloatingIP = &[]string{"172.20.0.1"}[0]
+	assert.Nil(t, lb.validateService(service))
+	update, err := lb.serviceLoadBalancers("10.2.11.200", service, lbSinglePort[0].nodes)
+	assert.Nil(t, err)
+	assert.Len(t, update[haproxyLBPrefix], 1)
+	assert.Len(t, update[lvsLBPrefix], 1)
+	assert.Equal(t, "UDP", update[lvsLBPrefix][0]["PROTOCOL"])
+	assert.Equal(t, "30053", update[lvsLBPrefix][0]["SERVER0_PORT"])
+
+	for _, protocol := range []corev1.Protocol{corev1.ProtocolSCTP, "QUIC"} {
+		service.Spec.Ports = append(service.Spec.Ports[:2], corev1.ServicePort{Name: "other", Protocol: protocol, Port: 443})
+		err = lb.validateService(service)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), fmt.Sprintf("protocol %s not supported", protocol))
+	}
+
+}
+
+func TestLBSourceRanges(t *testing.T) {
+	one := newLBFakeONe()
+	defer one.Close()
+
+	lb := &LoadBalancer{ctrl: one.controller(), publicNetwork: &ONEVirtualNetwork{Name: "public"}}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "Service0"},
+		Spec: corev1.ServiceSpec{
+			Type:                     corev1.ServiceTypeLoadBalancer,
+			Ports:                    []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}},
+			LoadBalancerSourceRanges: []string{"192.168.0.0/16"},
+		},
+	}
+
+	// New LBs can not be restricted to the source ranges, so nothing is created.
+	newService := service.DeepCopy()
+	newService.Name = "Service1"
+	_, err := lb.EnsureLoadBalancer(context.TODO(), "k8s", newService, lbSinglePort[0].nodes)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "loadBalancerSourceRanges [192.168.0.0/16] not supported")
+	assert.Equal(t, 0, one.callCount("one.vn.reserve"))
+	assert.Equal(t, 0, one.callCount("one.vm.updateconf"))
+
+	newService.Spec.LoadBalancerSourceRanges = []string{"10.0.0.0/33"}
+	assert.NotNil(t, lb.checkSourceRanges(newService, false))
+	newService.Spec.LoadBalancerSourceRanges = []string{"0.0.0.0/0"}
+	assert.Nil(t, lb.checkSourceRanges(newService, false))
+
+	// Existing LBs keep following node changes, the rendered context carries no client filter.
+	assert.Nil(t, lb.UpdateLoadBalancer(context.TODO(), "k8s", service, lbAddNode[1].nodes))
+	params := one.stringParams("one.vm.updateconf")
+	assert.Len(t, params, 2)
+	assert.Contains(t, params[1], `ONEAPP_VNF_HAPROXY_LB0_PORT="80"`)
+	assert.Contains(t, params[1], `ONEAPP_VNF_HAPROXY_LB0_SERVER1_HOST="172.20.0.103"`)
+	assert.NotContains(t, params[1], "192.168.0.0")
+	assert.NotContains(t, params[1], "ALLOWED_SOURCES")
+}
+
 func (s *CPTestSuite) TestLBSinglePort() {
 	s.testLB("lbSinglePort", lbSinglePort)
 }
@@ -324,6 +650,13 @@ func (s *CPTestSuite) TestLBDeleteSecondService() {
 	s.testLB("lbDeleteSecondService", lbDeleteSecondService)
 }
 
+func (s *CPTestSuite) TestLBMixedProtocols() {
+	if s.cfg.PrivateNetwork.FloatingIP == nil {
+		s.T().Skip("UDP needs privateNetwork.floatingIP, set PRIVATE_NETWORK_FLOATING_IP")
+	}
+	s.testLB("lbMixedProtocols", lbMixedProtocols)
+}
+
 func (s *CPTestSuite) testLB(name string, steps []lbStep) {
 	for _, step := range steps {
 		for _, service := range step.services {
@@ -395,3 +728,46 @@ func (s *CPTestSuite) verifyVRContextVec(clusterName string, contextMap map[stri
 	}
 	return nil
 }
+
+func TestLBSerializedUpdates(t *testing.T) {
+	one := newLBFakeONe()
+	defer one.Close()
+	lbVNet := `<VNET><ID>7</ID><NAME>k8s-lb</NAME><PARENT_NETWORK_ID>0</PARENT_NETWORK_ID><TEMPLATE></TEMPLATE><AR_POOL>
+<AR><AR_ID>1</AR_ID><IP>10.2.11.201</IP><SIZE>1</SIZE><TYPE>IP4</TYPE><LB_NAME>k8s-default-Service0</LB_NAME></AR>
+<AR><AR_ID>2</AR_ID><IP>10.2.11.202</IP><SIZE>1</SIZE><TYPE>IP4</TYPE><LB_NAME>k8s-default-Service1</LB_NAME></AR>
+</AR_POOL></VNET>`
+	one.setResponse("one.vnpool.info", `<VNET_POOL>`+lbVNet+`</VNET_POOL>`)
+	one.setResponse("one.vn.info", lbVNet)
+	one.delay = 5 * time.Millisecond
+
+	lb := &LoadBalancer{ctrl: one.controller(), publicNetwork: &ONEVirtualNetwork{Name: "public"}, class: "opennebula.io/virtual-router"}
+	ports := []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}}
+	services := []*corev1.Service{
+		// handled by the service controller
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "Service0"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, Ports: ports},
+		},
+		// handled by the LoadBalancerClass controller
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "Service1"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, Ports: ports, LoadBalancerClass: &lb.class},
+		},
+	}
+
+	// Both controllers read, merge and write the same VR context, interleaved updates would lose one of them.
+	wg := sync.WaitGroup{}
+	for _, service := range services {
+		wg.Add(1)
+		go func(service *corev1.Service) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				assert.Nil(t, lb.UpdateLoadBalancer(context.TODO(), "k8s", service, lbSinglePort[0].nodes))
+			}
+		}(service)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 6, one.callCount("one.vm.updateconf"))
+	assert.Equal(t, 1, one.concurrentCalls())
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+)
+
+const (
+	LoadBalancerClassControllerName  = "service-lb-class-controller"
+	LoadBalancerClassControllerAlias = "service-lb-class"
+
+	// NOTE: Not the upstream finalizer, the service-lb-controller would clean classed services up.
+	loadBalancerClassFinalizer = "opennebula.io/load-balancer-cleanup"
+)
+
+// StartLoadBalancerClassControllerWrapper is used to register LoadBalancerClassController in app.DefaultInitFuncConstructors.
+func StartLoadBalancerClassControllerWrapper(initContext app.ControllerInitContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+	return func(ctx context.Context, _ genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		one, ok := cloud.(*OpenNebula)
+		if !ok || one.loadBalancer.Disabled || len(one.loadBalancer.class) == 0 {
+			klog.Infof("loadBalancerClass not configured, will not handle classed services")
+			return nil, false, nil
+		}
+		c := NewLoadBalancerClassController(
+			one.loadBalancer,
+			completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName),
+			completedConfig.SharedInformers.Core().V1().Services(),
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+		)
+		go c.Run(ctx)
+		return nil, true, nil
+	}
+}
+
+// LoadBalancerClassController reconciles services of the configured LoadBalancerClass, which
+// the upstream service-lb-controller skips, it handles only services of the default class.
+type LoadBalancerClassController struct {
+	loadBalancer   *LoadBalancer
+	client         clientset.Interface
+	serviceLister  corelisters.ServiceLister
+	servicesSynced cache.InformerSynced
+	nodeLister     corelisters.NodeLister
+	nodesSynced    cache.InformerSynced
+	clusterName    string
+	queue          workqueue.TypedRateLimitingInterface[string]
+}
+
+func NewLoadBalancerClassController(loadBalancer *LoadBalancer, client clientset.Interface, serviceInformer coreinformers.ServiceInformer, nodeInformer coreinformers.NodeInformer, clusterName string) *LoadBalancerClassController {
+	c := &LoadBalancerClassController{
+		loadBalancer:   loadBalancer,
+		client:         client,
+		serviceLister:  serviceInformer.Lister(),
+		servicesSynced: serviceInformer.Informer().HasSynced,
+		nodeLister:     nodeInformer.Lister(),
+		nodesSynced:    nodeInformer.Informer().HasSynced,
+		clusterName:    clusterName,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: LoadBalancerClassControllerName},
+		),
+	}
+	serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueService,
+		UpdateFunc: func(_, obj interface{}) { c.enqueueService(obj) },
+	})
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { c.enqueueClaimedServices() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if isLoadBalancerBackend(oldObj.(*corev1.Node)) != isLoadBalancerBackend(newObj.(*corev1.Node)) {
+				c.enqueueClaimedServices()
+			}
+		},
+		DeleteFunc: func(interface{}) { c.enqueueClaimedServices() },
+	})
+	return c
+}
+
+func (c *LoadBalancerClassController) enqueueService(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *LoadBalancerClassController) enqueueClaimedServices() {
+	services, err := c.serviceLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, service := range services {
+		if c.claims(service) {
+			c.enqueueService(service)
+		}
+	}
+}
+
+// claims tells if the service is of the configured class, services of the default class
+// are left to the upstream service-lb-controller.
+func (c *LoadBalancerClassController) claims(service *corev1.Service) bool {
+	return service.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+		service.Spec.LoadBalancerClass != nil &&
+		*service.Spec.LoadBalancerClass == c.loadBalancer.class
+}
+
+func (c *LoadBalancerClassController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("starting %s", LoadBalancerClassControllerName)
+	defer klog.Infof("shutting down %s", LoadBalancerClassControllerName)
+
+	if !cache.WaitForNamedCacheSync(LoadBalancerClassControllerName, ctx.Done(), c.servicesSynced, c.nodesSynced) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+
+	<-ctx.Done()
+}
+
+func (c *LoadBalancerClassController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *LoadBalancerClassController) processNextWorkItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncService(ctx, key); err != nil {
+		klog.Errorf("sync of service %s failed: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *LoadBalancerClassController) syncService(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	cached, err := c.serviceLister.Services(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	service := cached.DeepCopy()
+
+	if service.DeletionTimestamp != nil || !c.claims(service) {
+		if !slices.Contains(service.Finalizers, loadBalancerClassFinalizer) {
+			return nil
+		}
+		if err := c.loadBalancer.EnsureLoadBalancerDeleted(ctx, c.clusterName, service); err != nil {
+			return err
+		}
+		updated := service.DeepCopy()
+		updated.Status.LoadBalancer = corev1.LoadBalancerStatus{}
+		updated.Finalizers = slices.DeleteFunc(updated.Finalizers, func(f string) bool { return f == loadBalancerClassFinalizer })
+		_, err := servicehelpers.PatchService(c.client.CoreV1(), service, updated)
+		return err
+	}
+
+	if !slices.Contains(service.Finalizers, loadBalancerClassFinalizer) {
+		updated := service.DeepCopy()
+		updated.Finalizers = append(updated.Finalizers, loadBalancerClassFinalizer)
+		if service, err = servicehelpers.PatchService(c.client.CoreV1(), service, updated); err != nil {
+			return err
+		}
+	}
+
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	backends := []*corev1.Node{}
+	for _, node := range nodes {
+		if isLoadBalancerBackend(node) {
+			backends = append(backends, node)
+		}
+	}
+	status, err := c.loadBalancer.EnsureLoadBalancer(ctx, c.clusterName, service, backends)
+	if err != nil {
+		return err
+	}
+	if servicehelpers.LoadBalancerStatusEqual(&service.Status.LoadBalancer, status) {
+		return nil
+	}
+	updated := service.DeepCopy()
+	updated.Status.LoadBalancer = *status
+	_, err = servicehelpers.PatchService(c.client.CoreV1(), service, updated)
+	return err
+}
+
+// isLoadBalancerBackend tells if the node is ready and not excluded from load balancers.
+func isLoadBalancerBackend(node *corev1.Node) bool {
+	if _, ok := node.Labels[corev1.LabelNodeExcludeBalancers]; ok {
+		return false
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadBalancerClaims(t *testing.T) {
+	lb, err := NewLoadBalancer(OpenNebulaConfig{
+		PublicNetwork: &ONEVirtualNetwork{Name: "public"},
+		VirtualRouter: &ONEVirtualRouter{TemplateName: "vr", LoadBalancerClass: "opennebula.io/virtual-router"},
+	})
+	assert.Nil(t, err)
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "Service0"}}
+	assert.True(t, lb.claims(service))
+	service.Spec.LoadBalancerClass = &[]string{"opennebula.io/virtual-router"}[0]
+	assert.True(t, lb.claims(service))
+
+	service.Spec.LoadBalancerClass = &[]string{"metallb.io/metallb"}[0]
+	assert.False(t, lb.claims(service))
+	status, exists, err := lb.GetLoadBalancer(context.TODO(), "k8s", service)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, status)
+	_, err = lb.EnsureLoadBalancer(context.TODO(), "k8s", service, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, lb.UpdateLoadBalancer(context.TODO(), "k8s", service, nil))
+	assert.Nil(t, lb.EnsureLoadBalancerDeleted(context.TODO(), "k8s", service))
+
+	lb.class = ""
+	service.Spec.LoadBalancerClass = &[]string{"opennebula.io/virtual-router"}[0]
+	assert.False(t, lb.claims(service))
+}
+
+func TestLoadBalancerClassController(t *testing.T) {
+	one := newFakeONe(map[string]string{"one.vnpool.info": `<VNET_POOL></VNET_POOL>`})
+	defer one.Close()
+
+	lb := &LoadBalancer{ctrl: one.controller(), publicNetwork: &ONEVirtualNetwork{Name: "public"}, class: "opennebula.io/virtual-router"}
+	deleted := metav1.Now()
+	client := fake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other"},
+			Spec: corev1.ServiceSpec{
+				Type:              corev1.ServiceTypeLoadBalancer,
+				LoadBalancerClass: &[]string{"metallb.io/metallb"}[0],
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              "deleted",
+				DeletionTimestamp: &deleted,
+				Finalizers:        []string{loadBalancerClassFinalizer},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:              corev1.ServiceTypeLoadBalancer,
+				LoadBalancerClass: &lb.class,
+			},
+		},
+	)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c := NewLoadBalancerClassController(lb, client, informerFactory.Core().V1().Services(), informerFactory.Core().V1().Nodes(), "k8s")
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+
+	assert.Nil(t, c.syncService(ctx, "default/other"))
+	service, err := client.CoreV1().Services("default").Get(ctx, "other", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, service.Finalizers)
+	assert.Equal(t, 0, one.callCount("one.vnpool.info"))
+
+	assert.Nil(t, c.syncService(ctx, "default/deleted"))
+	service, err = client.CoreV1().Services("default").Get(ctx, "deleted", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, service.Finalizers)
+	assert.Equal(t, 1, one.callCount("one.vnpool.info"))
+
+	assert.True(t, isLoadBalancerBackend(&corev1.Node{Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+		{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+	}}}))
+	assert.False(t, isLoadBalancerBackend(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{corev1.LabelNodeExcludeBalancers: ""}},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		}},
+	}))
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+)
+
+const (
+	LocalTrafficControllerName  = "service-lb-local-controller"
+	LocalTrafficControllerAlias = "service-lb-local"
+)
+
+// StartLocalTrafficControllerWrapper is used to register LocalTrafficController in app.DefaultInitFuncConstructors.
+func StartLocalTrafficControllerWrapper(initContext app.ControllerInitContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+	return func(ctx context.Context, _ genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		one, ok := cloud.(*OpenNebula)
+		if !ok || one.loadBalancer.Disabled {
+			klog.Infof("LoadBalancer disabled, will not follow endpoints of Local services")
+			return nil, false, nil
+		}
+		c := NewLocalTrafficController(
+			one.loadBalancer,
+			completedConfig.SharedInformers.Core().V1().Services(),
+			completedConfig.SharedInformers.Discovery().V1().EndpointSlices(),
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+		)
+		go c.Run(ctx)
+		return nil, true, nil
+	}
+}
+
+// LocalTrafficController updates LBs of services with externalTrafficPolicy: Local when their endpoints
+// move between nodes, the upstream service-lb-controller only reacts to service and node changes.
+type LocalTrafficController struct {
+	loadBalancer         *LoadBalancer
+	serviceLister        corelisters.ServiceLister
+	servicesSynced       cache.InformerSynced
+	endpointSliceLister  discoverylisters.EndpointSliceLister
+	endpointSlicesSynced cache.InformerSynced
+	nodeLister           corelisters.NodeLister
+	nodesSynced          cache.InformerSynced
+	clusterName          string
+	queue                workqueue.TypedRateLimitingInterface[string]
+	backends             map[string]string // last synced backend node names by service key
+}
+
+func NewLocalTrafficController(loadBalancer *LoadBalancer, serviceInformer coreinformers.ServiceInformer, endpointSliceInformer discoveryinformers.EndpointSliceInformer, nodeInformer coreinformers.NodeInformer, clusterName string) *LocalTrafficController {
+	c := &LocalTrafficController{
+		loadBalancer:         loadBalancer,
+		serviceLister:        serviceInformer.Lister(),
+		servicesSynced:       serviceInformer.Informer().HasSynced,
+		endpointSliceLister:  endpointSliceInformer.Lister(),
+		endpointSlicesSynced: endpointSliceInformer.Informer().HasSynced,
+		nodeLister:           nodeInformer.Lister(),
+		nodesSynced:          nodeInformer.Informer().HasSynced,
+		clusterName:          clusterName,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: LocalTrafficControllerName},
+		),
+		backends: map[string]string{},
+	}
+	endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueEndpointSlice,
+		UpdateFunc: func(_, obj interface{}) { c.enqueueEndpointSlice(obj) },
+		DeleteFunc: c.enqueueEndpointSlice,
+	})
+	return c
+}
+
+func (c *LocalTrafficController) enqueueEndpointSlice(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	serviceName, ok := slice.Labels[discoveryv1.LabelServiceName]
+	if !ok {
+		return
+	}
+	c.queue.Add(slice.Namespace + "/" + serviceName)
+}
+
+func (c *LocalTrafficController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("starting %s", LocalTrafficControllerName)
+	defer klog.Infof("shutting down %s", LocalTrafficControllerName)
+
+	if !cache.WaitForNamedCacheSync(LocalTrafficControllerName, ctx.Done(), c.servicesSynced, c.endpointSlicesSynced, c.nodesSynced) {
+		return
+	}
+	c.loadBalancer.followEndpoints()
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+
+	<-ctx.Done()
+}
+
+func (c *LocalTrafficController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *LocalTrafficController) processNextWorkItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncService(ctx, key); err != nil {
+		klog.Errorf("sync of Local service %s failed: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *LocalTrafficController) syncService(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	service, err := c.serviceLister.Services(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		delete(c.backends, key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer || !servicehelpers.RequestsOnlyLocalTraffic(service) || !c.loadBalancer.claims(service) {
+		delete(c.backends, key)
+		return nil
+	}
+	// NOTE: LBs are created by the service controllers, only existing ones are kept up to date here.
+	if _, exists, err := c.loadBalancer.GetLoadBalancer(ctx, c.clusterName, service); err != nil || !exists {
+		return err
+	}
+
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	candidates := []*corev1.Node{}
+	for _, node := range nodes {
+		if isLoadBalancerBackend(node) {
+			candidates = append(candidates, node)
+		}
+	}
+	endpointSlices, err := c.endpointSliceLister.EndpointSlices(namespace).List(labels.Set{discoveryv1.LabelServiceName: name}.AsSelector())
+	if err != nil {
+		return err
+	}
+	items := make([]discoveryv1.EndpointSlice, len(endpointSlices))
+	for i, slice := range endpointSlices {
+		items[i] = *slice
+	}
+	names := []string{}
+	for _, node := range filterLocalBackends(items, candidates) {
+		names = append(names, node.Name)
+	}
+	sort.Strings(names)
+	backends := strings.Join(names, ",")
+
+	if synced, ok := c.backends[key]; ok && synced == backends {
+		return nil
+	}
+	if err := c.loadBalancer.UpdateLoadBalancer(ctx, c.clusterName, service, candidates); err != nil {
+		return err
+	}
+	klog.Infof("updated LB backends of Local service %s: [%s]", key, backends)
+
+	c.backends[key] = backends
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLocalTrafficController(t *testing.T) {
+	one := newLBFakeONe()
+	defer one.Close()
+
+	ready := []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+	client := fake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "Service0"},
+			Spec: corev1.ServiceSpec{
+				Type:                  corev1.ServiceTypeLoadBalancer,
+				ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+				Ports:                 []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80, NodePort: 30080}},
+			},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "Node0"},
+			Status:     corev1.NodeStatus{Conditions: ready, Addresses: lbAddNode[1].nodes[0].Status.Addresses},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "Node1"},
+			Status:     corev1.NodeStatus{Conditions: ready, Addresses: lbAddNode[1].nodes[1].Status.Addresses},
+		},
+		newEndpointSlice("default", "Service0", map[string]bool{"Node0": false, "Node1": true}),
+	)
+	lb := &LoadBalancer{ctrl: one.controller(), publicNetwork: &ONEVirtualNetwork{Name: "public"}, client: client, localBackends: true}
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c := NewLocalTrafficController(lb,
+		informerFactory.Core().V1().Services(),
+		informerFactory.Discovery().V1().EndpointSlices(),
+		informerFactory.Core().V1().Nodes(),
+		"k8s",
+	)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+
+	assert.Nil(t, c.syncService(ctx, "default/Service0"))
+	params := one.stringParams("one.vm.updateconf")
+	assert.Len(t, params, 2)
+	assert.Contains(t, params[1], `ONEAPP_VNF_HAPROXY_LB0_SERVER0_HOST="172.20.0.103"`)
+	assert.NotContains(t, params[1], "172.20.0.102")
+	assert.NotContains(t, params[1], "ONEAPP_VNF_LB0_")
+
+	// Unchanged backends do not touch the VR.
+	assert.Nil(t, c.syncService(ctx, "default/Service0"))
+	assert.Equal(t, 1, one.callCount("one.vm.updateconf"))
+
+	assert.Nil(t, c.syncService(ctx, "default/Service1"))
+	assert.Equal(t, 1, one.callCount("one.vm.updateconf"))
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
+	goca_dyn "github.com/OpenNebula/one/src/oca/go/src/goca/dynamic"
+	goca_vn "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/virtualnetwork"
+)
+
+const defaultNodeIPAMMaskSize = 24
+
+// NodeIPAM allocates per-node pod CIDRs as CIDR-aligned reservations ("<cluster>-podcidr-<node>")
+// from an IPv4 address range of the configured VNET, so OpenNebula IPAM never leases them to VMs.
+type NodeIPAM struct {
+	Disabled       bool
+	ctrl           *goca.Controller
+	network        string
+	addressRangeID *int
+	nodeMaskSize   int
+
+	// NOTE: Serializes allocations, so concurrent syncs do not race for the same block.
+	mu sync.Mutex
+}
+
+func NewNodeIPAM(cfg OpenNebulaConfig) (*NodeIPAM, error) {
+	if cfg.NodeIPAM == nil {
+		return &NodeIPAM{Disabled: true}, nil
+	}
+	if len(cfg.NodeIPAM.Network) == 0 {
+		return nil, fmt.Errorf("no nodeIPAM network defined")
+	}
+	nodeMaskSize := defaultNodeIPAMMaskSize
+	if cfg.NodeIPAM.NodeMaskSize != 0 {
+		nodeMaskSize = cfg.NodeIPAM.NodeMaskSize
+	}
+	if nodeMaskSize < 8 || nodeMaskSize > 30 {
+		return nil, fmt.Errorf("unexpected nodeIPAM nodeMaskSize: %d", nodeMaskSize)
+	}
+	ctrl := goca.NewController(goca.NewDefaultClient(goca.OneConfig{
+		Endpoint: cfg.Endpoint.ONE_XMLRPC,
+		Token:    cfg.Endpoint.ONE_AUTH,
+	}))
+	return &NodeIPAM{
+		Disabled:       false,
+		ctrl:           ctrl,
+		network:        cfg.NodeIPAM.Network,
+		addressRangeID: cfg.NodeIPAM.AddressRangeID,
+		nodeMaskSize:   nodeMaskSize,
+	}, nil
+}
+
+func (ipam *NodeIPAM) getReservationPrefix(clusterName string) string {
+	return fmt.Sprintf("%s-podcidr-", clusterName)
+}
+
+func (ipam *NodeIPAM) getReservationName(clusterName, nodeName string) string {
+	return ipam.getReservationPrefix(clusterName) + nodeName
+}
+
+// Allocate returns the pod CIDR reserved for the node, reserving a free one first if needed.
+func (ipam *NodeIPAM) Allocate(ctx context.Context, clusterName, nodeName string) (string, error) {
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	name := ipam.getReservationName(clusterName, nodeName)
+	vnID, err := ipam.ctrl.VirtualNetworks().ByNameContext(ctx, name)
+	if err != nil && err.Error() != "resource not found" {
+		return "", err
+	}
+	if vnID >= 0 {
+		vn, err := ipam.ctrl.VirtualNetwork(vnID).InfoContext(ctx, false)
+		if err != nil {
+			return "", err
+		}
+		return reservationCIDR(vn)
+	}
+
+	parentID, err := ipam.ctrl.VirtualNetworks().ByNameContext(ctx, ipam.network)
+	if err != nil {
+		return "", err
+	}
+	parent, err := ipam.ctrl.VirtualNetwork(parentID).InfoContext(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	ar, err := ipam.addressRange(parent)
+	if err != nil {
+		return "", err
+	}
+
+	blockSize := uint32(1) << (32 - ipam.nodeMaskSize)
+	start := ipv4ToUint32(net.ParseIP(ar.IP))
+	end := uint64(start) + uint64(ar.Size)
+	first := (start + blockSize - 1) &^ (blockSize - 1)
+
+	leased := map[uint32]struct{}{}
+	for _, lease := range ar.Leases {
+		if ip := net.ParseIP(lease.IP); ip != nil && ip.To4() != nil {
+			leased[ipv4ToUint32(ip)&^(blockSize-1)] = struct{}{}
+		}
+	}
+
+	for base := uint64(first); base+uint64(blockSize) <= end; base += uint64(blockSize) {
+		if _, ok := leased[uint32(base)]; ok {
+			continue
+		}
+		ip := uint32ToIPv4(uint32(base))
+		reserve := &goca_dyn.Template{}
+		reserve.AddPair("NAME", name)
+		reserve.AddPair("SIZE", int(blockSize))
+		reserve.AddPair("AR_ID", ar.ID)
+		reserve.AddPair("IP", ip.String())
+		if _, err := ipam.ctrl.VirtualNetwork(parentID).ReserveContext(ctx, reserve.String()); err != nil {
+			// NOTE: Addresses may have been leased in the meantime, try the next block.
+			klog.V(2).Infof("unable to reserve %s/%d for node %s: %v", ip, ipam.nodeMaskSize, nodeName, err)
+			continue
+		}
+		cidr := fmt.Sprintf("%s/%d", ip, ipam.nodeMaskSize)
+		klog.Infof("reserved pod CIDR %s for node %s", cidr, nodeName)
+		return cidr, nil
+	}
+	return "", fmt.Errorf("no free /%d left in network %s", ipam.nodeMaskSize, ipam.network)
+}
+
+// Release deletes the node's reservation, returning its addresses to the parent VNET.
+func (ipam *NodeIPAM) Release(ctx context.Context, clusterName, nodeName string) error {
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	vnID, err := ipam.ctrl.VirtualNetworks().ByNameContext(ctx, ipam.getReservationName(clusterName, nodeName))
+	if err != nil {
+		if err.Error() == "resource not found" {
+			return nil
+		}
+		return err
+	}
+	if err := ipam.ctrl.VirtualNetwork(vnID).DeleteContext(ctx); err != nil {
+		return err
+	}
+	klog.Infof("released pod CIDR reservation of node %s", nodeName)
+	return nil
+}
+
+// Reservations returns names of all nodes holding a pod CIDR reservation.
+func (ipam *NodeIPAM) Reservations(ctx context.Context, clusterName string) ([]string, error) {
+	pool, err := ipam.ctrl.VirtualNetworks().InfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ipam.getReservationPrefix(clusterName)
+	nodeNames := []string{}
+	for _, vn := range pool.VirtualNetworks {
+		if len(vn.ParentNetworkID) > 0 && strings.HasPrefix(vn.Name, prefix) {
+			nodeNames = append(nodeNames, strings.TrimPrefix(vn.Name, prefix))
+		}
+	}
+	return nodeNames, nil
+}
+
+func (ipam *NodeIPAM) addressRange(vn *goca_vn.VirtualNetwork) (*goca_vn.AR, error) {
+	for i := range vn.ARs {
+		ar := &vn.ARs[i]
+		if ipam.addressRangeID != nil && ar.ID != strconv.Itoa(*ipam.addressRangeID) {
+			continue
+		}
+		if ip := net.ParseIP(ar.IP); ip != nil && ip.To4() != nil {
+			return ar, nil
+		}
+	}
+	return nil, fmt.Errorf("no IPv4 address range found in network %s", vn.Name)
+}
+
+func reservationCIDR(vn *goca_vn.VirtualNetwork) (string, error) {
+	if len(vn.ARs) != 1 || bits.OnesCount(uint(vn.ARs[0].Size)) != 1 {
+		return "", fmt.Errorf("unexpected pod CIDR reservation: %s", vn.Name)
+	}
+	return fmt.Sprintf("%s/%d", vn.ARs[0].IP, 32-bits.TrailingZeros(uint(vn.ARs[0].Size))), nil
+}
+
+func ipv4ToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIPv4(v uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip
+}
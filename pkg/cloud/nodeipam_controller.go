@@ -0,0 +1,198 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+)
+
+const (
+	NodeIPAMControllerName  = "node-ipam-controller"
+	NodeIPAMControllerAlias = "node-ipam"
+
+	nodeIPAMGCInterval = 5 * time.Minute
+)
+
+// StartNodeIPAMControllerWrapper is used to register NodeIPAMController in app.DefaultInitFuncConstructors.
+func StartNodeIPAMControllerWrapper(initContext app.ControllerInitContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+	return func(ctx context.Context, _ genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		one, ok := cloud.(*OpenNebula)
+		if !ok || one.nodeIPAM.Disabled {
+			klog.Infof("nodeIPAM not configured, will not allocate pod CIDRs")
+			return nil, false, nil
+		}
+		c := NewNodeIPAMController(
+			one.nodeIPAM,
+			completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName),
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+		)
+		go c.Run(ctx)
+		return nil, true, nil
+	}
+}
+
+// NodeIPAMController writes pod CIDRs reserved by NodeIPAM to node.Spec.PodCIDRs and releases them with the node.
+type NodeIPAMController struct {
+	ipam        *NodeIPAM
+	client      clientset.Interface
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	clusterName string
+	queue       workqueue.TypedRateLimitingInterface[string]
+}
+
+func NewNodeIPAMController(ipam *NodeIPAM, client clientset.Interface, nodeInformer coreinformers.NodeInformer, clusterName string) *NodeIPAMController {
+	c := &NodeIPAMController{
+		ipam:        ipam,
+		client:      client,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		clusterName: clusterName,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: NodeIPAMControllerName},
+		),
+	}
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueNode,
+		UpdateFunc: func(_, obj interface{}) { c.enqueueNode(obj) },
+		DeleteFunc: c.enqueueNode,
+	})
+	return c
+}
+
+func (c *NodeIPAMController) enqueueNode(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *NodeIPAMController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("starting %s", NodeIPAMControllerName)
+	defer klog.Infof("shutting down %s", NodeIPAMControllerName)
+
+	if !cache.WaitForNamedCacheSync(NodeIPAMControllerName, ctx.Done(), c.nodesSynced) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	// NOTE: Releases reservations of nodes deleted while the controller was not running.
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.releaseOrphans(ctx); err != nil {
+			klog.Errorf("pod CIDR garbage collection failed: %v", err)
+		}
+	}, nodeIPAMGCInterval)
+
+	<-ctx.Done()
+}
+
+func (c *NodeIPAMController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *NodeIPAMController) processNextWorkItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncNode(ctx, key); err != nil {
+		klog.Errorf("pod CIDR sync of node %s failed: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *NodeIPAMController) syncNode(ctx context.Context, nodeName string) error {
+	node, err := c.nodeLister.Get(nodeName)
+	if errors.IsNotFound(err) {
+		return c.ipam.Release(ctx, c.clusterName, nodeName)
+	}
+	if err != nil {
+		return err
+	}
+	if !node.DeletionTimestamp.IsZero() || len(node.Spec.PodCIDRs) > 0 || len(node.Spec.PodCIDR) > 0 {
+		return nil
+	}
+
+	podCIDR, err := c.ipam.Allocate(ctx, c.clusterName, node.Name)
+	if err != nil {
+		return err
+	}
+	return c.updatePodCIDR(ctx, node, podCIDR)
+}
+
+func (c *NodeIPAMController) updatePodCIDR(ctx context.Context, node *corev1.Node, podCIDR string) error {
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"podCIDR":  podCIDR,
+			"podCIDRs": []string{podCIDR},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.client.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	klog.Infof("set pod CIDR %s on node %s", podCIDR, node.Name)
+	return nil
+}
+
+func (c *NodeIPAMController) releaseOrphans(ctx context.Context) error {
+	nodeNames, err := c.ipam.Reservations(ctx, c.clusterName)
+	if err != nil {
+		return err
+	}
+	for _, nodeName := range nodeNames {
+		if _, err := c.nodeLister.Get(nodeName); errors.IsNotFound(err) {
+			c.queue.Add(nodeName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const podsVNet = `<VNET><ID>5</ID><NAME>pods</NAME><TEMPLATE></TEMPLATE><AR_POOL>
+<AR><AR_ID>0</AR_ID><IP>10.244.0.0</IP><SIZE>1024</SIZE><TYPE>IP4</TYPE><LEASES>
+<LEASE><IP>10.244.0.5</IP><VM>3</VM></LEASE>
+</LEASES></AR>
+</AR_POOL></VNET>`
+
+func newNodeIPAMFakeONe() *fakeONe {
+	return newFakeONe(map[string]string{
+		"one.vnpool.info": `<VNET_POOL>` + podsVNet + `</VNET_POOL>`,
+		"one.vn.info":     podsVNet,
+		"one.vn.reserve":  `6`,
+	})
+}
+
+func TestNodeIPAM(t *testing.T) {
+	one := newNodeIPAMFakeONe()
+	defer one.Close()
+
+	ipam, err := NewNodeIPAM(OpenNebulaConfig{
+		Endpoint: OpenNebulaEndpoint{ONE_XMLRPC: one.URL, ONE_AUTH: "oneadmin:test"},
+		NodeIPAM: &ONENodeIPAM{Network: "pods"},
+	})
+	assert.Nil(t, err)
+
+	podCIDR, err := ipam.Allocate(context.TODO(), "k8s", "node0")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.244.1.0/24", podCIDR)
+	params := one.stringParams("one.vn.reserve")
+	assert.Len(t, params, 2)
+	assert.Contains(t, params[1], `NAME="k8s-podcidr-node0"`)
+	assert.Contains(t, params[1], `IP="10.244.1.0"`)
+	assert.Contains(t, params[1], `SIZE="256"`)
+
+	one.setResponse("one.vnpool.info", `<VNET_POOL>`+podsVNet+
+		`<VNET><ID>6</ID><NAME>k8s-podcidr-node0</NAME><PARENT_NETWORK_ID>5</PARENT_NETWORK_ID><TEMPLATE></TEMPLATE></VNET></VNET_POOL>`)
+	one.setResponse("one.vn.info", `<VNET><ID>6</ID><NAME>k8s-podcidr-node0</NAME><TEMPLATE></TEMPLATE><AR_POOL>
+<AR><AR_ID>0</AR_ID><IP>10.244.1.0</IP><SIZE>256</SIZE><TYPE>IP4</TYPE></AR></AR_POOL></VNET>`)
+	podCIDR, err = ipam.Allocate(context.TODO(), "k8s", "node0")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.244.1.0/24", podCIDR)
+	assert.Equal(t, 1, one.callCount("one.vn.reserve"))
+
+	nodeNames, err := ipam.Reservations(context.TODO(), "k8s")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"node0"}, nodeNames)
+
+	_, err = NewNodeIPAM(OpenNebulaConfig{NodeIPAM: &ONENodeIPAM{Network: "pods", NodeMaskSize: 31}})
+	assert.NotNil(t, err)
+}
+
+func TestNodeIPAMController(t *testing.T) {
+	one := newNodeIPAMFakeONe()
+	defer one.Close()
+
+	ipam, err := NewNodeIPAM(OpenNebulaConfig{
+		Endpoint: OpenNebulaEndpoint{ONE_XMLRPC: one.URL, ONE_AUTH: "oneadmin:test"},
+		NodeIPAM: &ONENodeIPAM{Network: "pods", NodeMaskSize: 23},
+	})
+	assert.Nil(t, err)
+
+	client := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node0"}})
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c := NewNodeIPAMController(ipam, client, informerFactory.Core().V1().Nodes(), "k8s")
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+
+	assert.Nil(t, c.syncNode(ctx, "node0"))
+	node, err := client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.244.2.0/23"}, node.Spec.PodCIDRs)
+
+	// NOTE: The node is gone, but there is no reservation in the fake pool.
+	assert.Nil(t, c.syncNode(ctx, "node1"))
+	assert.Equal(t, 0, one.callCount("one.vn.delete"))
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+
+	goca_dyn "github.com/OpenNebula/one/src/oca/go/src/goca/dynamic"
+	"github.com/OpenNebula/one/src/oca/go/src/goca/parameters"
+)
+
+const (
+	NodeMetadataControllerName  = "node-metadata-controller"
+	NodeMetadataControllerAlias = "node-metadata"
+
+	nodeNameAttribute        = "K8S_NODE_NAME"
+	nodeLabelAttributePrefix = "K8S_NODE_LABEL_"
+
+	nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+)
+
+// StartNodeMetadataControllerWrapper is used to register NodeMetadataController in app.DefaultInitFuncConstructors.
+func StartNodeMetadataControllerWrapper(initContext app.ControllerInitContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+	return func(ctx context.Context, _ genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		one, ok := cloud.(*OpenNebula)
+		if !ok || one.instancesV2.Disabled || one.nodeMetadata == nil {
+			klog.Infof("nodeMetadata not configured, will not write node metadata to VMs")
+			return nil, false, nil
+		}
+		c := NewNodeMetadataController(
+			one.instancesV2,
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+			*one.nodeMetadata,
+		)
+		go c.Run(ctx)
+		return nil, true, nil
+	}
+}
+
+// NodeMetadataController writes node name, roles, cluster name and selected labels into
+// the USER_TEMPLATE of node VMs, so they can be identified from the OpenNebula side.
+type NodeMetadataController struct {
+	instancesV2 *InstancesV2
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	clusterName string
+	labels      []string
+	queue       workqueue.TypedRateLimitingInterface[string]
+}
+
+func NewNodeMetadataController(instancesV2 *InstancesV2, nodeInformer coreinformers.NodeInformer, clusterName string, cfg ONENodeMetadata) *NodeMetadataController {
+	c := &NodeMetadataController{
+		instancesV2: instancesV2,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		clusterName: clusterName,
+		labels:      cfg.Labels,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: NodeMetadataControllerName},
+		),
+	}
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueNode,
+		UpdateFunc: func(_, obj interface{}) { c.enqueueNode(obj) },
+	})
+	return c
+}
+
+func (c *NodeMetadataController) enqueueNode(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *NodeMetadataController) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("starting %s", NodeMetadataControllerName)
+	defer klog.Infof("shutting down %s", NodeMetadataControllerName)
+
+	if !cache.WaitForNamedCacheSync(NodeMetadataControllerName, ctx.Done(), c.nodesSynced) {
+		return
+	}
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+
+	<-ctx.Done()
+}
+
+func (c *NodeMetadataController) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *NodeMetadataController) processNextWorkItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncNode(ctx, key); err != nil {
+		klog.Errorf("metadata sync of node %s failed: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *NodeMetadataController) syncNode(ctx context.Context, nodeName string) error {
+	node, err := c.nodeLister.Get(nodeName)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// NOTE: Uninitialized nodes are handled by the cloud-node controller first.
+	if len(node.Spec.ProviderID) == 0 {
+		return nil
+	}
+	vm, err := c.instancesV2.byNode(ctx, node)
+	if err != nil || vm == nil {
+		return err
+	}
+
+	update := goca_dyn.NewTemplate()
+	for k, v := range c.expectedAttributes(node) {
+		if current, err := vm.UserTemplate.GetStr(k); err == nil && current == v {
+			continue
+		}
+		// NOTE: An attribute with no value (and no previous value) is not worth adding.
+		if _, err := vm.UserTemplate.GetStr(k); err != nil && len(v) == 0 {
+			continue
+		}
+		update.AddPair(k, v)
+	}
+	if len(update.Elements) == 0 {
+		return nil
+	}
+	if err := c.instancesV2.ctrl.VM(vm.ID).UpdateContext(ctx, update.String(), parameters.Merge); err != nil {
+		return err
+	}
+	klog.Infof("updated USER_TEMPLATE of VM %d (node %s)", vm.ID, node.Name)
+	return nil
+}
+
+// expectedAttributes returns USER_TEMPLATE attributes describing the node, labels missing on the node
+// are cleared (set to an empty value), since merge updates can not remove attributes.
+func (c *NodeMetadataController) expectedAttributes(node *corev1.Node) map[string]string {
+	roles := []string{}
+	for k := range node.Labels {
+		if strings.HasPrefix(k, nodeRoleLabelPrefix) && len(k) > len(nodeRoleLabelPrefix) {
+			roles = append(roles, strings.TrimPrefix(k, nodeRoleLabelPrefix))
+		}
+	}
+	sort.Strings(roles)
+
+	attributes := map[string]string{
+		nodeNameAttribute:  node.Name,
+		nodeRolesAttribute: strings.Join(roles, ","),
+	}
+	// NOTE: A configured clusterTag is what instanceScope matches VMs by, never overwrite it with the cluster name.
+	switch scope := c.instancesV2.scope; {
+	case len(scope.ClusterTag) > 0:
+		attributes[scope.ClusterTagAttribute] = scope.ClusterTag
+	case len(c.clusterName) > 0:
+		attributes[scope.ClusterTagAttribute] = c.clusterName
+	}
+	for _, k := range c.labels {
+		attributes[nodeLabelAttribute(k)] = node.Labels[k]
+	}
+	return attributes
+}
+
+// nodeLabelAttribute turns a label key like "topology.kubernetes.io/zone" into "K8S_NODE_LABEL_TOPOLOGY_KUBERNETES_IO_ZONE".
+func nodeLabelAttribute(key string) string {
+	return nodeLabelAttributePrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const taggedNodeVM = `<VM><ID>40</ID><NAME>node0</NAME><TEMPLATE></TEMPLATE><USER_TEMPLATE>
+<K8S_NODE_NAME>node0</K8S_NODE_NAME><K8S_NODE_LABEL_TOPOLOGY_KUBERNETES_IO_ZONE>rack_a</K8S_NODE_LABEL_TOPOLOGY_KUBERNETES_IO_ZONE>
+</USER_TEMPLATE></VM>`
+
+func TestNodeMetadataController(t *testing.T) {
+	one := newFakeONe(map[string]string{
+		"one.vm.info":   taggedNodeVM,
+		"one.vm.update": `40`,
+	})
+	defer one.Close()
+
+	lifecycle, err := resolveInstanceLifecycle(OpenNebulaConfig{})
+	assert.Nil(t, err)
+	i2 := &InstancesV2{ctrl: one.controller(), lifecycle: lifecycle, scope: resolveInstanceScope(OpenNebulaConfig{})}
+
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0", Labels: map[string]string{
+			"node-role.kubernetes.io/worker":        "",
+			"node-role.kubernetes.io/control-plane": "",
+			"example.com/pool":                      "gpu",
+		}},
+		Spec: corev1.NodeSpec{ProviderID: "one://40"},
+	})
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c := NewNodeMetadataController(i2, informerFactory.Core().V1().Nodes(), "kubernetes", ONENodeMetadata{
+		Labels: []string{"example.com/pool", "topology.kubernetes.io/zone", "missing"},
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+
+	assert.Nil(t, c.syncNode(ctx, "node0"))
+	assert.Equal(t, 1, one.callCount("one.vm.update"))
+	params := one.stringParams("one.vm.update")
+	assert.Len(t, params, 2)
+	assert.Contains(t, params[1], `K8S_NODE_ROLES="control-plane,worker"`)
+	assert.Contains(t, params[1], `K8S_CLUSTER="kubernetes"`)
+	assert.Contains(t, params[1], `K8S_NODE_LABEL_EXAMPLE_COM_POOL="gpu"`)
+	assert.Contains(t, params[1], `K8S_NODE_LABEL_TOPOLOGY_KUBERNETES_IO_ZONE=""`)
+	assert.NotContains(t, params[1], "K8S_NODE_NAME")
+	assert.NotContains(t, params[1], "K8S_NODE_LABEL_MISSING")
+
+	assert.Nil(t, c.syncNode(ctx, "node1"))
+	assert.Equal(t, 1, one.callCount("one.vm.update"))
+
+	i2.scope = resolveInstanceScope(OpenNebulaConfig{InstanceScope: &ONEInstanceScope{ClusterTag: "prod-eu"}})
+	assert.Nil(t, c.syncNode(ctx, "node0"))
+	params = one.stringParams("one.vm.update")
+	assert.Len(t, params, 2)
+	assert.Contains(t, params[1], `K8S_CLUSTER="prod-eu"`)
+	assert.NotContains(t, params[1], `K8S_CLUSTER="kubernetes"`)
+}
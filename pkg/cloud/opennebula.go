@@ -19,6 +19,7 @@ package opennebula
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"gopkg.in/yaml.v3"
 	cloudprovider "k8s.io/cloud-provider"
@@ -30,6 +31,13 @@ const (
 
 type OpenNebula struct {
 	instancesV2  *InstancesV2
+	instances    *Instances
+	zones        *Zones
+	routes       *Routes
+	clusters     *Clusters
+	nodeIPAM     *NodeIPAM
+	hostTaint    ONEHostTaint
+	nodeMetadata *ONENodeMetadata
 	loadBalancer *LoadBalancer
 }
 
@@ -42,6 +50,19 @@ type OpenNebulaConfig struct {
 	VirtualRouter  *ONEVirtualRouter  `yaml:"virtualRouter"`
 	PublicNetwork  *ONEVirtualNetwork `yaml:"publicNetwork,omitempty"`
 	PrivateNetwork *ONEVirtualNetwork `yaml:"privateNetwork,omitempty"`
+	Inventory      *ONEInventory      `yaml:"inventory,omitempty"`
+	Events         *ONEEvents         `yaml:"events,omitempty"`
+	NodeAddresses  *ONENodeAddresses  `yaml:"nodeAddresses,omitempty"`
+	InstanceType   *ONEInstanceType   `yaml:"instanceType,omitempty"`
+	Topology       *ONETopology       `yaml:"topology,omitempty"`
+	InstanceStates *ONEInstanceStates `yaml:"instanceStates,omitempty"`
+	NodeLabels     *ONENodeLabels     `yaml:"nodeLabels,omitempty"`
+	HostLabels     *ONEHostLabels     `yaml:"hostLabels,omitempty"`
+	InstanceScope  *ONEInstanceScope  `yaml:"instanceScope,omitempty"`
+	Routes         *ONERoutes         `yaml:"routes,omitempty"`
+	NodeIPAM       *ONENodeIPAM       `yaml:"nodeIPAM,omitempty"`
+	HostTaint      *ONEHostTaint      `yaml:"hostTaint,omitempty"`
+	NodeMetadata   *ONENodeMetadata   `yaml:"nodeMetadata,omitempty"`
 }
 
 type OpenNebulaEndpoint struct {
@@ -50,9 +71,10 @@ type OpenNebulaEndpoint struct {
 }
 
 type ONEVirtualRouter struct {
-	TemplateName string            `yaml:"templateName"`
-	Replicas     *int32            `yaml:"replicas,omitempty"`
-	ExtraContext map[string]string `yaml:"extraContext,omitempty"`
+	TemplateName      string            `yaml:"templateName"`
+	Replicas          *int32            `yaml:"replicas,omitempty"`
+	ExtraContext      map[string]string `yaml:"extraContext,omitempty"`
+	LoadBalancerClass string            `yaml:"loadBalancerClass,omitempty"` // handled besides the default class
 }
 
 type ONEVirtualNetwork struct {
@@ -64,6 +86,81 @@ type ONEVirtualNetwork struct {
 	DNS            *string `yaml:"dns,omitempty"`
 }
 
+type ONEInventory struct {
+	RefreshInterval *time.Duration `yaml:"refreshInterval,omitempty"`
+}
+
+type ONEEvents struct {
+	Endpoint   string         `yaml:"endpoint"`
+	MinBackoff *time.Duration `yaml:"minBackoff,omitempty"`
+	MaxBackoff *time.Duration `yaml:"maxBackoff,omitempty"`
+}
+
+type ONENodeAddresses struct {
+	PreferredFamily   string              `yaml:"preferredFamily,omitempty"`
+	Internal          *ONEAddressSelector `yaml:"internal,omitempty"`
+	External          *ONEAddressSelector `yaml:"external,omitempty"`
+	InternalDNSSuffix string              `yaml:"internalDNSSuffix,omitempty"`
+	ExternalDNSSuffix string              `yaml:"externalDNSSuffix,omitempty"`
+}
+
+type ONEAddressSelector struct {
+	Networks []string `yaml:"networks,omitempty"` // names or IDs
+	NICs     []int    `yaml:"nics,omitempty"`     // NIC_IDs
+}
+
+type ONEInstanceType struct {
+	Source    string `yaml:"source"` // template, attribute or capacity
+	Attribute string `yaml:"attribute,omitempty"`
+}
+
+type ONETopology struct {
+	Region    string `yaml:"region,omitempty"`    // OpenNebula zone name by default (discovered with oneadmin credentials only)
+	ZoneLevel string `yaml:"zoneLevel,omitempty"` // cluster (default) or host
+}
+
+type ONEInstanceStates struct {
+	Gone     []string `yaml:"gone,omitempty"`
+	Shutdown []string `yaml:"shutdown,omitempty"`
+}
+
+type ONENodeLabels struct {
+	Prefix     string   `yaml:"prefix,omitempty"`     // stripped from the attribute name, K8S_LABEL_ by default
+	Attributes []string `yaml:"attributes,omitempty"` // copied with the attribute name as the label key
+}
+
+type ONEHostLabels struct {
+	Disabled     bool           `yaml:"disabled,omitempty"`
+	SyncInterval *time.Duration `yaml:"syncInterval,omitempty"` // 1m by default
+}
+
+type ONEInstanceScope struct {
+	Owner               string `yaml:"owner,omitempty"` // user name or ID
+	Group               string `yaml:"group,omitempty"` // group name or ID
+	NamePrefix          string `yaml:"namePrefix,omitempty"`
+	ClusterTagAttribute string `yaml:"clusterTagAttribute,omitempty"` // USER_TEMPLATE attribute, K8S_CLUSTER by default
+	ClusterTag          string `yaml:"clusterTag,omitempty"`
+}
+
+type ONERoutes struct {
+	Network string `yaml:"network,omitempty"` // privateNetwork by default
+}
+
+type ONENodeIPAM struct {
+	Network        string `yaml:"network"`
+	AddressRangeID *int   `yaml:"addressRangeID,omitempty"` // first IPv4 AR by default
+	NodeMaskSize   int    `yaml:"nodeMaskSize,omitempty"`   // 24 by default
+}
+
+type ONEHostTaint struct {
+	Effect       string         `yaml:"effect,omitempty"`       // NoSchedule by default
+	SyncInterval *time.Duration `yaml:"syncInterval,omitempty"` // 1m by default
+}
+
+type ONENodeMetadata struct {
+	Labels []string `yaml:"labels,omitempty"` // node label keys to copy
+}
+
 func init() {
 	cloudprovider.RegisterCloudProvider(ProviderName, func(reader io.Reader) (cloudprovider.Interface, error) {
 		cfg, err := ReadConfig(reader)
@@ -79,12 +176,31 @@ func NewOpenNebula(cfg *Config) (cloudprovider.Interface, error) {
 	if err != nil {
 		return nil, err
 	}
+	routes, err := NewRoutes(cfg.OpenNebula)
+	if err != nil {
+		return nil, err
+	}
+	nodeIPAM, err := NewNodeIPAM(cfg.OpenNebula)
+	if err != nil {
+		return nil, err
+	}
 	loadBalancer, err := NewLoadBalancer(cfg.OpenNebula)
 	if err != nil {
 		return nil, err
 	}
+	hostTaint := ONEHostTaint{}
+	if cfg.OpenNebula.HostTaint != nil {
+		hostTaint = *cfg.OpenNebula.HostTaint
+	}
 	return &OpenNebula{
 		instancesV2:  instancesV2,
+		instances:    NewInstances(instancesV2),
+		zones:        NewZones(instancesV2),
+		routes:       routes,
+		clusters:     NewClusters(cfg.OpenNebula, instancesV2.inventory),
+		nodeIPAM:     nodeIPAM,
+		hostTaint:    hostTaint,
+		nodeMetadata: cfg.OpenNebula.NodeMetadata,
 		loadBalancer: loadBalancer,
 	}, nil
 }
@@ -101,6 +217,14 @@ func ReadConfig(reader io.Reader) (*Config, error) {
 }
 
 func (one *OpenNebula) Initialize(builder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
+	one.instancesV2.client = builder.ClientOrDie("opennebula-cloud-provider")
+	one.loadBalancer.client = one.instancesV2.client
+	if one.instancesV2.events != nil {
+		go one.instancesV2.events.Run(stop)
+	}
+	if !one.instancesV2.Disabled && !one.instancesV2.hostLabelsCfg.Disabled {
+		go NewHostLabeler(one.instancesV2, one.instancesV2.client, one.instancesV2.hostLabelsCfg).Run(stop)
+	}
 }
 
 func (one *OpenNebula) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
@@ -108,7 +232,7 @@ func (one *OpenNebula) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
 }
 
 func (one *OpenNebula) Instances() (cloudprovider.Instances, bool) {
-	return nil, false
+	return one.instances, !one.instancesV2.Disabled
 }
 
 func (one *OpenNebula) InstancesV2() (cloudprovider.InstancesV2, bool) {
@@ -116,15 +240,15 @@ func (one *OpenNebula) InstancesV2() (cloudprovider.InstancesV2, bool) {
 }
 
 func (one *OpenNebula) Zones() (cloudprovider.Zones, bool) {
-	return nil, false
+	return one.zones, !one.instancesV2.Disabled
 }
 
 func (one *OpenNebula) Clusters() (cloudprovider.Clusters, bool) {
-	return nil, false
+	return one.clusters, true
 }
 
 func (one *OpenNebula) Routes() (cloudprovider.Routes, bool) {
-	return nil, false
+	return one.routes, !one.routes.Disabled
 }
 
 func (one *OpenNebula) ProviderName() string {
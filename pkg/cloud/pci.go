@@ -0,0 +1,78 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const (
+	pciLabelPrefix      = "opennebula.io/pci-"
+	pciClassLabelPrefix = "opennebula.io/pci-class-"
+	vgpuLabelPrefix     = "opennebula.io/vgpu-"
+)
+
+// pciLabels counts PCI passthrough devices by vendor/device and class, and vGPU devices by profile,
+// e.g. "opennebula.io/pci-10de-1db6": "1", "opennebula.io/pci-class-0302": "1".
+func pciLabels(vm *goca_vm.VM) map[string]string {
+	counts := map[string]int{}
+	for _, pci := range vm.Template.GetVectors("PCI") {
+		vendor, _ := pci.GetStr("VENDOR")
+		device, _ := pci.GetStr("DEVICE")
+		if vendor, device = normalizePCIID(vendor), normalizePCIID(device); len(vendor) > 0 && len(device) > 0 {
+			counts[fmt.Sprintf("%s%s-%s", pciLabelPrefix, vendor, device)]++
+		}
+		if class, _ := pci.GetStr("CLASS"); len(normalizePCIID(class)) > 0 {
+			counts[pciClassLabelPrefix+normalizePCIID(class)]++
+		}
+		if profile, _ := pci.GetStr("PROFILE"); len(sanitizeLabelValue(profile)) > 0 {
+			counts[vgpuLabelPrefix+sanitizeLabelValue(profile)]++
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	labels := map[string]string{}
+	for k, v := range counts {
+		// NOTE: Long vGPU profiles (or zero padded IDs) exceed the 63 characters allowed in the name part.
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			klog.Warningf("VM %d: skipping invalid label key %q: %s", vm.ID, k, strings.Join(errs, ", "))
+			continue
+		}
+		labels[k] = strconv.Itoa(v)
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// normalizePCIID turns "0x10DE" or "10de" into "10de", anything not hexadecimal into "".
+func normalizePCIID(id string) string {
+	id = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(id)), "0x")
+	if _, err := strconv.ParseUint(id, 16, 32); err != nil {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const acceleratedVM = `<VM><ID>60</ID><NAME>gpu0</NAME><TEMPLATE>
+<PCI><ADDRESS>0000:3b:00.0</ADDRESS><CLASS>0302</CLASS><DEVICE>1db6</DEVICE><PCI_ID>0</PCI_ID><SHORT_ADDRESS>3b:00.0</SHORT_ADDRESS><VENDOR>10de</VENDOR></PCI>
+<PCI><ADDRESS>0000:d8:00.0</ADDRESS><CLASS>0302</CLASS><DEVICE>1DB6</DEVICE><PCI_ID>1</PCI_ID><VENDOR>0x10de</VENDOR></PCI>
+<PCI><CLASS>0302</CLASS><DEVICE>20b7</DEVICE><PROFILE>nvidia-558</PROFILE><VENDOR>10de</VENDOR></PCI>
+<PCI><SHORT_ADDRESS>af:00.1</SHORT_ADDRESS></PCI>
+</TEMPLATE></VM>`
+
+func TestPCILabels(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"opennebula.io/pci-10de-1db6":   "2",
+		"opennebula.io/pci-10de-20b7":   "1",
+		"opennebula.io/pci-class-0302":  "3",
+		"opennebula.io/vgpu-nvidia-558": "1",
+	}, pciLabels(mustParseVM(t, acceleratedVM)))
+
+	assert.Nil(t, pciLabels(mustParseVM(t, sizedVM)))
+
+	// The name part of "opennebula.io/vgpu-<profile>" is longer than the 63 characters allowed.
+	longProfileVM := `<VM><ID>61</ID><NAME>gpu1</NAME><TEMPLATE>
+<PCI><CLASS>0302</CLASS><DEVICE>20b7</DEVICE><PROFILE>nvidia-a100-7-80c-mig-7g-80gb-with-a-very-long-profile-name</PROFILE><VENDOR>10de</VENDOR></PCI>
+</TEMPLATE></VM>`
+	assert.Equal(t, map[string]string{
+		"opennebula.io/pci-10de-20b7":  "1",
+		"opennebula.io/pci-class-0302": "1",
+	}, pciLabels(mustParseVM(t, longProfileVM)))
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
+	goca_dyn "github.com/OpenNebula/one/src/oca/go/src/goca/dynamic"
+	"github.com/OpenNebula/one/src/oca/go/src/goca/parameters"
+)
+
+const (
+	// Every pod-CIDR route is recorded in the VNET template as a vector, so it can be listed per cluster.
+	routeVectorKey = "K8S_ROUTE"
+	// Routes in the "<destination> via <gateway>" format, passed to VM contexts as ETH<n>_ROUTES.
+	routesKey = "ROUTES"
+)
+
+// Routes manages per-node pod-CIDR routes on the private VNET.
+type Routes struct {
+	Disabled bool
+	ctrl     *goca.Controller
+	network  string
+
+	// NOTE: The route controller creates routes concurrently and the VNET template is updated as a whole.
+	mu sync.Mutex
+}
+
+func NewRoutes(cfg OpenNebulaConfig) (*Routes, error) {
+	disabled := cfg.Routes == nil
+	network := ""
+	if cfg.PrivateNetwork != nil {
+		network = cfg.PrivateNetwork.Name
+	}
+	if cfg.Routes != nil && len(cfg.Routes.Network) > 0 {
+		network = cfg.Routes.Network
+	}
+	if !disabled && len(network) == 0 {
+		klog.Errorf("no network defined, disabling Routes")
+		disabled = true
+	}
+	ctrl := goca.NewController(goca.NewDefaultClient(goca.OneConfig{
+		Endpoint: cfg.Endpoint.ONE_XMLRPC,
+		Token:    cfg.Endpoint.ONE_AUTH,
+	}))
+	return &Routes{
+		Disabled: disabled,
+		ctrl:     ctrl,
+		network:  network,
+	}, nil
+}
+
+func (r *Routes) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
+	if r.Disabled {
+		return nil, fmt.Errorf("Routes disabled")
+	}
+	_, tpl, err := r.networkTemplate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return listRoutes(tpl, clusterName), nil
+}
+
+func (r *Routes) CreateRoute(ctx context.Context, clusterName string, nameHint string, route *cloudprovider.Route) error {
+	klog.Infof("CreateRoute(): %s %s -> %s", clusterName, route.DestinationCIDR, route.TargetNode)
+
+	if r.Disabled {
+		return fmt.Errorf("Routes disabled")
+	}
+	gateway, err := routeGateway(route)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	vnID, tpl, err := r.networkTemplate(ctx)
+	if err != nil {
+		return err
+	}
+	updateRoutes(tpl, func() {
+		removeRoutes(tpl, clusterName, route.DestinationCIDR)
+		vec := tpl.AddVector(routeVectorKey)
+		vec.AddPair("CLUSTER", clusterName)
+		vec.AddPair("NAME", fmt.Sprintf("%s-%s", clusterName, nameHint))
+		vec.AddPair("NODE", string(route.TargetNode))
+		vec.AddPair("DESTINATION", route.DestinationCIDR)
+		vec.AddPair("GATEWAY", gateway)
+	})
+	return r.ctrl.VirtualNetwork(vnID).UpdateContext(ctx, tpl.String(), parameters.Replace)
+}
+
+func (r *Routes) DeleteRoute(ctx context.Context, clusterName string, route *cloudprovider.Route) error {
+	klog.Infof("DeleteRoute(): %s %s", clusterName, route.DestinationCIDR)
+
+	if r.Disabled {
+		return fmt.Errorf("Routes disabled")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	vnID, tpl, err := r.networkTemplate(ctx)
+	if err != nil {
+		return err
+	}
+	updateRoutes(tpl, func() {
+		removeRoutes(tpl, clusterName, route.DestinationCIDR)
+	})
+	return r.ctrl.VirtualNetwork(vnID).UpdateContext(ctx, tpl.String(), parameters.Replace)
+}
+
+func (r *Routes) networkTemplate(ctx context.Context) (int, *goca_dyn.Template, error) {
+	vnID, err := r.ctrl.VirtualNetworks().ByNameContext(ctx, r.network)
+	if err != nil {
+		return -1, nil, err
+	}
+	vn, err := r.ctrl.VirtualNetwork(vnID).InfoContext(ctx, true)
+	if err != nil {
+		return -1, nil, err
+	}
+	return vnID, &vn.Template.Template, nil
+}
+
+// routeGateway picks the node's InternalIP of the same family as the destination CIDR.
+func routeGateway(route *cloudprovider.Route) (string, error) {
+	_, cidr, err := net.ParseCIDR(route.DestinationCIDR)
+	if err != nil {
+		return "", err
+	}
+	wantIPv4 := cidr.IP.To4() != nil
+	for _, addr := range route.TargetNodeAddresses {
+		ip := net.ParseIP(addr.Address)
+		if addr.Type != corev1.NodeInternalIP || ip == nil {
+			continue
+		}
+		if (ip.To4() != nil) == wantIPv4 {
+			return addr.Address, nil
+		}
+	}
+	return "", fmt.Errorf("no InternalIP for route %s on node %s", route.DestinationCIDR, route.TargetNode)
+}
+
+func listRoutes(tpl *goca_dyn.Template, clusterName string) []*cloudprovider.Route {
+	routes := []*cloudprovider.Route{}
+	for _, vec := range tpl.GetVectors(routeVectorKey) {
+		if v, _ := vec.GetStr("CLUSTER"); v != clusterName {
+			continue
+		}
+		name, _ := vec.GetStr("NAME")
+		node, _ := vec.GetStr("NODE")
+		destination, _ := vec.GetStr("DESTINATION")
+		gateway, _ := vec.GetStr("GATEWAY")
+		routes = append(routes, &cloudprovider.Route{
+			Name:            name,
+			TargetNode:      types.NodeName(node),
+			DestinationCIDR: destination,
+			TargetNodeAddresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: gateway},
+			},
+		})
+	}
+	return routes
+}
+
+func removeRoutes(tpl *goca_dyn.Template, clusterName, destination string) {
+	for i, s := 0, len(tpl.Elements); i < s; {
+		vec, ok := tpl.Elements[i].(*goca_dyn.Vector)
+		if ok && vec.Key() == routeVectorKey {
+			c, _ := vec.GetStr("CLUSTER")
+			d, _ := vec.GetStr("DESTINATION")
+			if c == clusterName && d == destination {
+				tpl.Elements = append(tpl.Elements[:i], tpl.Elements[i+1:]...)
+				s--
+				continue
+			}
+		}
+		i++
+	}
+}
+
+// updateRoutes applies the change to the route vectors and regenerates the managed part of ROUTES,
+// routes added to ROUTES by other means are kept intact.
+func updateRoutes(tpl *goca_dyn.Template, change func()) {
+	managed := map[string]struct{}{}
+	for _, vec := range tpl.GetVectors(routeVectorKey) {
+		d, _ := vec.GetStr("DESTINATION")
+		managed[d] = struct{}{}
+	}
+
+	change()
+
+	entries := []string{}
+	if v, err := tpl.GetStr(routesKey); err == nil {
+		for _, entry := range strings.Split(v, ",") {
+			entry = strings.TrimSpace(entry)
+			if len(entry) == 0 {
+				continue
+			}
+			if _, ok := managed[strings.Fields(entry)[0]]; ok {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	managedEntries := []string{}
+	for _, vec := range tpl.GetVectors(routeVectorKey) {
+		d, _ := vec.GetStr("DESTINATION")
+		g, _ := vec.GetStr("GATEWAY")
+		managedEntries = append(managedEntries, fmt.Sprintf("%s via %s", d, g))
+	}
+	sort.Strings(managedEntries)
+	entries = append(entries, managedEntries...)
+
+	tpl.Del(routesKey)
+	if len(entries) > 0 {
+		tpl.AddPair(routesKey, strings.Join(entries, ", "))
+	}
+}
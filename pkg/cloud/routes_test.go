@@ -0,0 +1,100 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+
+	goca_vn "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/virtualnetwork"
+)
+
+const routedVNet = `<VNET><ID>1</ID><NAME>private</NAME><TEMPLATE>
+<ROUTES><![CDATA[192.168.0.0/16 via 172.20.0.1, 10.244.0.0/24 via 172.20.0.100]]></ROUTES>
+<K8S_ROUTE><CLUSTER>k8s</CLUSTER><NAME>k8s-uid0</NAME><NODE>node0</NODE><DESTINATION>10.244.0.0/24</DESTINATION><GATEWAY>172.20.0.100</GATEWAY></K8S_ROUTE>
+<K8S_ROUTE><CLUSTER>other</CLUSTER><NAME>other-uid0</NAME><NODE>node0</NODE><DESTINATION>10.245.0.0/24</DESTINATION><GATEWAY>172.20.0.200</GATEWAY></K8S_ROUTE>
+</TEMPLATE><AR_POOL></AR_POOL></VNET>`
+
+func TestRoutesTemplate(t *testing.T) {
+	vn := &goca_vn.VirtualNetwork{}
+	assert.Nil(t, xml.Unmarshal([]byte(routedVNet), vn))
+	tpl := &vn.Template.Template
+
+	routes := listRoutes(tpl, "k8s")
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "node0", string(routes[0].TargetNode))
+	assert.Equal(t, "10.244.0.0/24", routes[0].DestinationCIDR)
+
+	updateRoutes(tpl, func() {
+		removeRoutes(tpl, "k8s", "10.244.0.0/24")
+	})
+	assert.Len(t, listRoutes(tpl, "k8s"), 0)
+	assert.Len(t, listRoutes(tpl, "other"), 1)
+	routesAttr, err := tpl.GetStr(routesKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.0.0/16 via 172.20.0.1, 10.245.0.0/24 via 172.20.0.200", routesAttr)
+}
+
+func TestCreateRoute(t *testing.T) {
+	one := newFakeONe(map[string]string{
+		"one.vnpool.info": `<VNET_POOL>` + routedVNet + `</VNET_POOL>`,
+		"one.vn.info":     routedVNet,
+		"one.vn.update":   `1`,
+	})
+	defer one.Close()
+
+	routes, err := NewRoutes(OpenNebulaConfig{
+		Endpoint:       OpenNebulaEndpoint{ONE_XMLRPC: one.URL, ONE_AUTH: "oneadmin:test"},
+		PrivateNetwork: &ONEVirtualNetwork{Name: "private"},
+		Routes:         &ONERoutes{},
+	})
+	assert.Nil(t, err)
+	assert.False(t, routes.Disabled)
+
+	err = routes.CreateRoute(context.TODO(), "k8s", "uid1", &cloudprovider.Route{
+		TargetNode:      "node1",
+		DestinationCIDR: "10.244.1.0/24",
+		TargetNodeAddresses: []corev1.NodeAddress{
+			{Type: corev1.NodeExternalIP, Address: "10.2.11.101"},
+			{Type: corev1.NodeInternalIP, Address: "172.20.0.101"},
+		},
+	})
+	assert.Nil(t, err)
+	params := one.stringParams("one.vn.update")
+	assert.Len(t, params, 2)
+	assert.Contains(t, params[1], `ROUTES="192.168.0.0/16 via 172.20.0.1, 10.244.0.0/24 via 172.20.0.100, 10.244.1.0/24 via 172.20.0.101, 10.245.0.0/24 via 172.20.0.200"`)
+	assert.Contains(t, params[1], `NODE="node1"`)
+
+	err = routes.CreateRoute(context.TODO(), "k8s", "uid2", &cloudprovider.Route{
+		TargetNode:      "node2",
+		DestinationCIDR: "fd00:10:244:2::/64",
+		TargetNodeAddresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "172.20.0.102"},
+		},
+	})
+	assert.NotNil(t, err)
+
+	routes, err = NewRoutes(OpenNebulaConfig{PrivateNetwork: &ONEVirtualNetwork{Name: "private"}})
+	assert.Nil(t, err)
+	assert.True(t, routes.Disabled)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"strconv"
+	"strings"
+
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const defaultClusterTagAttribute = "K8S_CLUSTER"
+
+func resolveInstanceScope(cfg OpenNebulaConfig) ONEInstanceScope {
+	resolved := ONEInstanceScope{}
+	if cfg.InstanceScope != nil {
+		resolved = *cfg.InstanceScope
+	}
+	if len(resolved.ClusterTagAttribute) == 0 {
+		resolved.ClusterTagAttribute = defaultClusterTagAttribute
+	}
+	return resolved
+}
+
+// contains returns true if the VM matches all configured criteria.
+func (scope ONEInstanceScope) contains(vm *goca_vm.VM) bool {
+	if len(scope.Owner) > 0 && scope.Owner != vm.UName && scope.Owner != strconv.Itoa(vm.UID) {
+		return false
+	}
+	if len(scope.Group) > 0 && scope.Group != vm.GName && scope.Group != strconv.Itoa(vm.GID) {
+		return false
+	}
+	if len(scope.NamePrefix) > 0 && !strings.HasPrefix(vm.Name, scope.NamePrefix) {
+		return false
+	}
+	if len(scope.ClusterTag) > 0 {
+		clusterTag, err := vm.UserTemplate.GetStr(scope.ClusterTagAttribute)
+		if err != nil || clusterTag != scope.ClusterTag {
+			return false
+		}
+	}
+	return true
+}
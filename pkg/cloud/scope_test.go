@@ -0,0 +1,64 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const clonedPool = `<VM_POOL>
+<VM><ID>70</ID><UID>2</UID><GID>100</GID><UNAME>k8s-a</UNAME><GNAME>k8s</GNAME><NAME>a-node0</NAME><STATE>3</STATE><LCM_STATE>3</LCM_STATE>
+<TEMPLATE><OS><UUID>uuid-70</UUID></OS></TEMPLATE><USER_TEMPLATE><K8S_CLUSTER>a</K8S_CLUSTER></USER_TEMPLATE></VM>
+<VM><ID>71</ID><UID>3</UID><GID>100</GID><UNAME>k8s-b</UNAME><GNAME>k8s</GNAME><NAME>b-node0</NAME><STATE>3</STATE><LCM_STATE>3</LCM_STATE>
+<TEMPLATE><OS><UUID>uuid-70</UUID></OS></TEMPLATE><USER_TEMPLATE><K8S_CLUSTER>b</K8S_CLUSTER></USER_TEMPLATE></VM>
+</VM_POOL>`
+
+func TestInstanceScope(t *testing.T) {
+	one := newFakeONe(map[string]string{"one.vmpool.infoextended": clonedPool})
+	defer one.Close()
+
+	interval := time.Hour
+	for _, inventory := range []*Inventory{nil, NewInventory(one.controller(), ONEInventory{RefreshInterval: &interval})} {
+		i2 := &InstancesV2{ctrl: one.controller(), inventory: inventory, scope: resolveInstanceScope(OpenNebulaConfig{})}
+		_, err := i2.byUUID(context.TODO(), "uuid-70")
+		assert.NotNil(t, err)
+
+		for _, tc := range []struct {
+			scope    ONEInstanceScope
+			expected int
+		}{
+			{ONEInstanceScope{Owner: "k8s-a"}, 70},
+			{ONEInstanceScope{Owner: "3", Group: "k8s"}, 71},
+			{ONEInstanceScope{NamePrefix: "a-"}, 70},
+			{ONEInstanceScope{ClusterTag: "b"}, 71},
+		} {
+			i2.scope = resolveInstanceScope(OpenNebulaConfig{InstanceScope: &tc.scope})
+			vm, err := i2.byUUID(context.TODO(), "uuid-70")
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, vm.ID)
+		}
+
+		i2.scope = resolveInstanceScope(OpenNebulaConfig{InstanceScope: &ONEInstanceScope{Group: "users"}})
+		vm, err := i2.byUUID(context.TODO(), "uuid-70")
+		assert.Nil(t, err)
+		assert.Nil(t, vm)
+	}
+}
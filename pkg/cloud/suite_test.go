@@ -88,10 +88,14 @@ func (s *CPTestSuite) SetupSuite() {
 		s.T().Fatal("PublicNetwork.Name must not be empty")
 	}
 
+	var privateFloatingIP *string
+	if v := os.Getenv("PRIVATE_NETWORK_FLOATING_IP"); v != "" {
+		privateFloatingIP = &v
+	}
 	s.cfg.PrivateNetwork = &ONEVirtualNetwork{
 		Name:           os.Getenv("PRIVATE_NETWORK_NAME"),
 		AddressRangeID: nil,
-		FloatingIP:     nil,
+		FloatingIP:     privateFloatingIP,
 		FloatingOnly:   nil,
 		Gateway:        nil,
 		DNS:            nil,
@@ -0,0 +1,163 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sync"
+	"time"
+
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	goca "github.com/OpenNebula/one/src/oca/go/src/goca"
+	goca_vm "github.com/OpenNebula/one/src/oca/go/src/goca/schemas/vm"
+)
+
+const (
+	topologyZoneLevelCluster = "cluster"
+	topologyZoneLevelHost    = "host"
+
+	// How long to wait before retrying a failed region discovery.
+	regionDiscoveryRetry = 10 * time.Minute
+)
+
+// Topology maps OpenNebula zone to Kubernetes region and OpenNebula cluster (or host) to Kubernetes zone.
+type Topology struct {
+	ctrl      *goca.Controller
+	zoneLevel string
+
+	mu           sync.Mutex
+	region       string
+	regionRetry  time.Time // no region discovery before
+	clusterNames map[int]string
+}
+
+func NewTopology(ctrl *goca.Controller, cfg OpenNebulaConfig) (*Topology, error) {
+	resolved := ONETopology{}
+	if cfg.Topology != nil {
+		resolved = *cfg.Topology
+	}
+	switch resolved.ZoneLevel {
+	case "":
+		resolved.ZoneLevel = topologyZoneLevelCluster
+	case topologyZoneLevelCluster, topologyZoneLevelHost:
+	default:
+		return nil, fmt.Errorf("unexpected topology zoneLevel: %s", resolved.ZoneLevel)
+	}
+	return &Topology{
+		ctrl:         ctrl,
+		zoneLevel:    resolved.ZoneLevel,
+		region:       sanitizeLabelValue(resolved.Region),
+		clusterNames: map[int]string{},
+	}, nil
+}
+
+// lastHistory returns the most recent placement of the VM, or nil if it has never been deployed.
+func lastHistory(vm *goca_vm.VM) *goca_vm.HistoryRecord {
+	var last *goca_vm.HistoryRecord
+	for i := range vm.HistoryRecords {
+		if last == nil || vm.HistoryRecords[i].SEQ > last.SEQ {
+			last = &vm.HistoryRecords[i]
+		}
+	}
+	return last
+}
+
+func (t *Topology) Zone(ctx context.Context, vm *goca_vm.VM) (cloudprovider.Zone, error) {
+	zone := cloudprovider.Zone{}
+
+	region, err := t.Region(ctx)
+	if err != nil {
+		return zone, err
+	}
+	zone.Region = region
+
+	history := lastHistory(vm)
+	if history == nil {
+		return zone, nil
+	}
+	switch t.zoneLevel {
+	case topologyZoneLevelHost:
+		zone.FailureDomain = sanitizeLabelValue(history.Hostname)
+	default:
+		clusterName, err := t.clusterName(ctx, history.CID)
+		if err != nil {
+			return zone, err
+		}
+		zone.FailureDomain = clusterName
+	}
+	return zone, nil
+}
+
+func (t *Topology) clusterName(ctx context.Context, clusterID int) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v, ok := t.clusterNames[clusterID]; ok {
+		return v, nil
+	}
+	cluster, err := t.ctrl.Cluster(clusterID).InfoContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.clusterNames[clusterID] = sanitizeLabelValue(cluster.Name)
+	return t.clusterNames[clusterID], nil
+}
+
+// Region returns the configured region or the name of the OpenNebula zone oned belongs to.
+// Discovery needs one.system.config, which oned allows only to the oneadmin group, so a failed
+// discovery leaves the region empty instead of failing the node initialization.
+func (t *Topology) Region(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.region) > 0 || time.Now().Before(t.regionRetry) {
+		return t.region, nil
+	}
+
+	zoneID, err := t.discoverZoneID(ctx)
+	if err != nil {
+		klog.Warningf("region discovery failed, set topology.region to label nodes with a region: %v", err)
+		t.regionRetry = time.Now().Add(regionDiscoveryRetry)
+		return "", nil
+	}
+	zone, err := t.ctrl.Zone(zoneID).InfoContext(ctx, false)
+	if err != nil {
+		klog.Warningf("region discovery failed, set topology.region to label nodes with a region: %v", err)
+		t.regionRetry = time.Now().Add(regionDiscoveryRetry)
+		return "", nil
+	}
+	t.region = sanitizeLabelValue(zone.Name)
+	klog.Infof("discovered region %q (OpenNebula zone %d)", t.region, zoneID)
+
+	return t.region, nil
+}
+
+func (t *Topology) discoverZoneID(ctx context.Context) (int, error) {
+	body, err := t.ctrl.SystemConfigContext(ctx)
+	if err != nil {
+		return -1, err
+	}
+	systemConfig := struct {
+		ZoneID int `xml:"FEDERATION>ZONE_ID"`
+	}{}
+	if err := xml.Unmarshal([]byte(body), &systemConfig); err != nil {
+		return -1, err
+	}
+	return systemConfig.ZoneID, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+const placedVM = `<VM><ID>40</ID><NAME>node0</NAME><TEMPLATE></TEMPLATE><HISTORY_RECORDS>
+<HISTORY><OID>40</OID><SEQ>0</SEQ><HOSTNAME>kvm-a1</HOSTNAME><HID>1</HID><CID>100</CID></HISTORY>
+<HISTORY><OID>40</OID><SEQ>1</SEQ><HOSTNAME>kvm-b2</HOSTNAME><HID>2</HID><CID>101</CID></HISTORY>
+</HISTORY_RECORDS></VM>`
+
+func newTopologyFakeONe() *fakeONe {
+	return newFakeONe(map[string]string{
+		"one.system.config": `<OPENNEBULA_CONFIGURATION><FEDERATION><MODE>STANDALONE</MODE><ZONE_ID>0</ZONE_ID></FEDERATION></OPENNEBULA_CONFIGURATION>`,
+		"one.zone.info":     `<ZONE><ID>0</ID><NAME>OpenNebula</NAME><TEMPLATE></TEMPLATE></ZONE>`,
+		"one.cluster.info":  `<CLUSTER><ID>101</ID><NAME>rack b</NAME><TEMPLATE></TEMPLATE></CLUSTER>`,
+	})
+}
+
+func TestTopologyZone(t *testing.T) {
+	one := newTopologyFakeONe()
+	defer one.Close()
+
+	vm := mustParseVM(t, placedVM)
+
+	topology, err := NewTopology(one.controller(), OpenNebulaConfig{})
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		zone, err := topology.Zone(context.TODO(), vm)
+		assert.Nil(t, err)
+		assert.Equal(t, cloudprovider.Zone{FailureDomain: "rack_b", Region: "OpenNebula"}, zone)
+	}
+	assert.Equal(t, 1, one.callCount("one.system.config"))
+	assert.Equal(t, 1, one.callCount("one.cluster.info"))
+
+	topology, err = NewTopology(one.controller(), OpenNebulaConfig{Topology: &ONETopology{Region: "eu-west", ZoneLevel: "host"}})
+	assert.Nil(t, err)
+	zone, err := topology.Zone(context.TODO(), vm)
+	assert.Nil(t, err)
+	assert.Equal(t, cloudprovider.Zone{FailureDomain: "kvm-b2", Region: "eu-west"}, zone)
+
+	_, err = NewTopology(one.controller(), OpenNebulaConfig{Topology: &ONETopology{ZoneLevel: "rack"}})
+	assert.NotNil(t, err)
+}
+
+func TestTopologyRegionNotAdmin(t *testing.T) {
+	// NOTE: Without a canned body the fake fails one.system.config, like oned does for users outside the oneadmin group.
+	one := newFakeONe(map[string]string{
+		"one.zone.info":    `<ZONE><ID>0</ID><NAME>OpenNebula</NAME><TEMPLATE></TEMPLATE></ZONE>`,
+		"one.cluster.info": `<CLUSTER><ID>101</ID><NAME>rack b</NAME><TEMPLATE></TEMPLATE></CLUSTER>`,
+	})
+	defer one.Close()
+
+	topology, err := NewTopology(one.controller(), OpenNebulaConfig{})
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		zone, err := topology.Zone(context.TODO(), mustParseVM(t, placedVM))
+		assert.Nil(t, err)
+		assert.Equal(t, cloudprovider.Zone{FailureDomain: "rack_b"}, zone)
+	}
+	assert.Equal(t, 1, one.callCount("one.system.config"))
+	assert.Equal(t, 0, one.callCount("one.zone.info"))
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// Zones implements the legacy Zones interface on top of InstancesV2 lookups and Topology.
+type Zones struct {
+	instancesV2 *InstancesV2
+}
+
+func NewZones(instancesV2 *InstancesV2) *Zones {
+	return &Zones{
+		instancesV2: instancesV2,
+	}
+}
+
+func (z *Zones) GetZone(_ context.Context) (cloudprovider.Zone, error) {
+	return cloudprovider.Zone{}, cloudprovider.NotImplemented
+}
+
+func (z *Zones) GetZoneByProviderID(ctx context.Context, providerID string) (cloudprovider.Zone, error) {
+	vm, err := z.instancesV2.byProviderID(ctx, providerID)
+	if err != nil {
+		return cloudprovider.Zone{}, err
+	}
+	if vm == nil {
+		return cloudprovider.Zone{}, cloudprovider.InstanceNotFound
+	}
+	return z.instancesV2.topology.Zone(ctx, vm)
+}
+
+func (z *Zones) GetZoneByNodeName(ctx context.Context, nodeName types.NodeName) (cloudprovider.Zone, error) {
+	vm, err := z.instancesV2.byNodeName(ctx, nodeName)
+	if err != nil {
+		return cloudprovider.Zone{}, err
+	}
+	if vm == nil {
+		return cloudprovider.Zone{}, cloudprovider.InstanceNotFound
+	}
+	return z.instancesV2.topology.Zone(ctx, vm)
+}
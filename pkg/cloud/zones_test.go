@@ -0,0 +1,58 @@
+/*
+Copyright 2024, OpenNebula Project, OpenNebula Systems.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opennebula
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestZones(t *testing.T) {
+	one := newTopologyFakeONe()
+	defer one.Close()
+	one.setResponse("one.vm.info", placedVM)
+
+	topology, err := NewTopology(one.controller(), OpenNebulaConfig{})
+	assert.Nil(t, err)
+	lifecycle, err := resolveInstanceLifecycle(OpenNebulaConfig{})
+	assert.Nil(t, err)
+	zones := NewZones(&InstancesV2{ctrl: one.controller(), topology: topology, lifecycle: lifecycle})
+	zones.instancesV2.client = fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+		Spec:       corev1.NodeSpec{ProviderID: "one://40"},
+	})
+
+	expected := cloudprovider.Zone{FailureDomain: "rack_b", Region: "OpenNebula"}
+
+	zone, err := zones.GetZoneByProviderID(context.TODO(), "one://40")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, zone)
+
+	zone, err = zones.GetZoneByNodeName(context.TODO(), "node0")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, zone)
+
+	_, err = zones.GetZoneByNodeName(context.TODO(), "node1")
+	assert.NotNil(t, err)
+}